@@ -0,0 +1,88 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"sync"
+)
+
+type accumulatorKey struct{}
+
+// accumulator collects Data as a Func progresses so partial results survive
+// a panic
+type accumulator struct {
+	mutex sync.Mutex
+	data  map[string]interface{}
+}
+
+func (a *accumulator) set(key string, value interface{}) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.data == nil {
+		a.data = map[string]interface{}{}
+	}
+	a.data[key] = value
+}
+
+// snapshot returns a copy of the accumulated data or nil if none
+func (a *accumulator) snapshot() map[string]interface{} {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if len(a.data) == 0 {
+		return nil
+	}
+	data := make(map[string]interface{}, len(a.data))
+	for k, v := range a.data {
+		data[k] = v
+	}
+	return data
+}
+
+// merge returns data with the accumulated values added; values already
+// present in data take precedence
+func (a *accumulator) merge(data map[string]interface{}) map[string]interface{} {
+	acc := a.snapshot()
+	if acc == nil {
+		return data
+	}
+	for k, v := range data {
+		acc[k] = v
+	}
+	return acc
+}
+
+// Accumulate records an attribute of the reply Data as a Func progresses
+// e.g. immediately after each sub-resource is provisioned.  Accumulated
+// values are merged into the Data of a successful Response, with values
+// already in Response.Data taking precedence.  See WithPartialDataOnPanic.
+//
+// Accumulate is a no-op when ctx was not provided by a Handler.
+func Accumulate(ctx context.Context, key string, value interface{}) {
+	if a, ok := ctx.Value(accumulatorKey{}).(*accumulator); ok {
+		a.set(key, value)
+	}
+}
+
+// WithPartialDataOnPanic includes the Data recorded via Accumulate in the
+// FAILED reply sent when the Func panics so operators can see how far
+// provisioning got.  By default, FAILED replies contain no Data.
+func WithPartialDataOnPanic() Option {
+	return func(o *options) {
+		o.partialDataOnPanic = true
+	}
+}
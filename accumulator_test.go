@@ -0,0 +1,86 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestAccumulate(t *testing.T) {
+	var (
+		ctx = context.Background()
+		fn  = func(ctx context.Context, req *Request) (*Response, error) {
+			Accumulate(ctx, "BucketArn", "arn:aws:s3:::bucket")
+			if req.RequestType == RequestTypeUpdate {
+				panic("boom")
+			}
+			Accumulate(ctx, "QueueArn", "arn:aws:sqs:queue")
+			return &Response{
+				PhysicalResourceId: "abc",
+				Data:               map[string]interface{}{"QueueArn": "override"},
+			}, nil
+		}
+	)
+
+	testCases := map[string]struct {
+		RequestType string
+		Options     []Option
+		Status      string
+		Data        interface{}
+	}{
+		"success merges": {
+			RequestType: RequestTypeCreate,
+			Status:      StatusSuccess,
+			Data: map[string]interface{}{
+				"BucketArn": "arn:aws:s3:::bucket",
+				"QueueArn":  "override",
+			},
+		},
+		"panic without option": {
+			RequestType: RequestTypeUpdate,
+			Status:      StatusFailed,
+			Data:        nil,
+		},
+		"panic with option": {
+			RequestType: RequestTypeUpdate,
+			Options:     []Option{WithPartialDataOnPanic()},
+			Status:      StatusFailed,
+			Data:        map[string]interface{}{"BucketArn": "arn:aws:s3:::bucket"},
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var input ReplyInput
+			opts := append([]Option{WithTransport(captureReply(t, &input))}, tc.Options...)
+			handler := New(fn, opts...)
+			if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: tc.RequestType})); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Status, tc.Status; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := input.Data, tc.Data; !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+
+	t.Run("no handler", func(t *testing.T) {
+		Accumulate(ctx, "key", "value") // must not panic
+	})
+}
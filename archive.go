@@ -0,0 +1,137 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// Uploader stores the archived outcome of an invocation.  Typically backed by
+// the AWS SDK e.g.
+//
+//	func (u s3Uploader) Upload(ctx context.Context, bucket, key string, body []byte) error {
+//		_, err := u.api.PutObjectWithContext(ctx, &s3.PutObjectInput{
+//			Bucket: aws.String(bucket),
+//			Key:    aws.String(key),
+//			Body:   bytes.NewReader(body),
+//		})
+//		return err
+//	}
+type Uploader interface {
+	Upload(ctx context.Context, bucket, key string, body []byte) error
+}
+
+// Outcome is the json document archived by WithOutcomeArchive
+type Outcome struct {
+	Request   *Request
+	Reply     *ReplyInput
+	Error     string `json:",omitempty"`
+	Timestamp time.Time
+}
+
+type archive struct {
+	uploader  Uploader
+	bucket    string
+	keyPrefix string
+}
+
+// stackName returns the name of the stack from the StackId arn e.g.
+// arn:aws:cloudformation:us-east-1:123456789012:stack/name/guid
+func stackName(stackId string) string {
+	if index := strings.Index(stackId, ":stack/"); index >= 0 {
+		stackId = stackId[index+len(":stack/"):]
+	}
+	if index := strings.Index(stackId, "/"); index >= 0 {
+		stackId = stackId[:index]
+	}
+	return stackId
+}
+
+func (a *archive) key(req *Request, timestamp time.Time) string {
+	return path.Join(
+		a.keyPrefix,
+		stackName(req.StackId),
+		req.LogicalResourceId,
+		req.RequestType,
+		timestamp.UTC().Format("20060102T150405.000000000Z")+".json",
+	)
+}
+
+// redactOutcome returns copies of req and reply safe to archive.  The
+// ResponseURL is a presigned url, so it is dropped, and NoEcho Data values
+// are replaced by their hash.
+func redactOutcome(req *Request, reply *ReplyInput) (*Request, *ReplyInput) {
+	r := *req
+	r.ResponseURL = ""
+	req = &r
+
+	if reply != nil && reply.NoEcho && reply.Data != nil {
+		input := *reply
+		if data, ok := reply.Data.(map[string]interface{}); ok {
+			hashed := make(map[string]interface{}, len(data))
+			for k, v := range data {
+				hashed[k] = hashValue(v)
+			}
+			input.Data = hashed
+		} else {
+			input.Data = hashValue(reply.Data)
+		}
+		reply = &input
+	}
+
+	return req, reply
+}
+
+// store uploads the outcome
+func (a *archive) store(ctx context.Context, req *Request, reply *ReplyInput, err error, timestamp time.Time) error {
+	redactedReq, redactedReply := redactOutcome(req, reply)
+	outcome := Outcome{
+		Request:   redactedReq,
+		Reply:     redactedReply,
+		Timestamp: timestamp,
+	}
+	if err != nil {
+		outcome.Error = err.Error()
+	}
+
+	data, err := json.Marshal(outcome)
+	if err != nil {
+		return fmt.Errorf("unable to encode outcome: %v", err)
+	}
+
+	return a.uploader.Upload(ctx, a.bucket, a.key(req, timestamp), data)
+}
+
+// WithOutcomeArchive uploads an Outcome document, containing the request,
+// the reply, and any error, to bucket after each invocation.  The presigned
+// ResponseURL is omitted and NoEcho Data is hashed.  Upload failures
+// are logged rather than failing the invocation.  Keys take the
+// form {keyPrefix}/{stack name}/{logical id}/{request type}/{timestamp}.json
+func WithOutcomeArchive(uploader Uploader, bucket, keyPrefix string) Option {
+	return func(o *options) {
+		if uploader != nil {
+			o.archive = &archive{
+				uploader:  uploader,
+				bucket:    bucket,
+				keyPrefix: keyPrefix,
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type fakeUploader struct {
+	bucket string
+	key    string
+	body   []byte
+	err    error
+}
+
+func (f *fakeUploader) Upload(ctx context.Context, bucket, key string, body []byte) error {
+	f.bucket = bucket
+	f.key = key
+	f.body = body
+	return f.err
+}
+
+func TestWithOutcomeArchive(t *testing.T) {
+	const stackId = "arn:aws:cloudformation:us-east-1:123456789012:stack/my-stack/guid"
+
+	t.Run("failure", func(t *testing.T) {
+		var (
+			ctx      = context.Background()
+			input    ReplyInput
+			uploader = &fakeUploader{}
+			fn       = func(ctx context.Context, req *Request) (*Response, error) {
+				return nil, errors.New("boom")
+			}
+		)
+
+		handler := New(fn, WithTransport(captureReply(t, &input)), WithOutcomeArchive(uploader, "bucket", "audit"))
+		data := marshalRequest(t, Request{RequestType: RequestTypeCreate, StackId: stackId, LogicalResourceId: "Resource"})
+		if _, err := handler.Invoke(ctx, data); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := uploader.bucket, "bucket"; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if want := "audit/my-stack/Resource/Create/"; !strings.HasPrefix(uploader.key, want) || !strings.HasSuffix(uploader.key, ".json") {
+			t.Fatalf("got %v; want %v*.json", uploader.key, want)
+		}
+
+		var outcome Outcome
+		if err := json.Unmarshal(uploader.body, &outcome); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := outcome.Request.StackId, stackId; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := outcome.Reply.Status, StatusFailed; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := outcome.Error, "boom"; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if outcome.Timestamp.IsZero() {
+			t.Fatalf("got zero; want timestamp")
+		}
+	})
+
+	t.Run("redacted", func(t *testing.T) {
+		var (
+			ctx      = context.Background()
+			input    ReplyInput
+			uploader = &fakeUploader{}
+			fn       = func(ctx context.Context, req *Request) (*Response, error) {
+				return &Response{
+					PhysicalResourceId: "abc",
+					NoEcho:             true,
+					Data:               map[string]interface{}{"Password": "hunter2"},
+				}, nil
+			}
+		)
+
+		handler := New(fn, WithTransport(captureReply(t, &input)), WithOutcomeArchive(uploader, "bucket", ""))
+		data := marshalRequest(t, Request{RequestType: RequestTypeCreate, ResponseURL: "https://example.com/signed?X-Amz-Signature=secret"})
+		if _, err := handler.Invoke(ctx, data); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := input.Data, map[string]interface{}{"Password": "hunter2"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+
+		body := string(uploader.body)
+		for _, secret := range []string{"hunter2", "X-Amz-Signature"} {
+			if strings.Contains(body, secret) {
+				t.Fatalf("got %v; want %v redacted", body, secret)
+			}
+		}
+
+		var outcome Outcome
+		if err := json.Unmarshal(uploader.body, &outcome); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := outcome.Reply.Data, map[string]interface{}{"Password": hashValue("hunter2")}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("upload failure logged", func(t *testing.T) {
+		var (
+			ctx      = context.Background()
+			buf      = bytes.NewBuffer(nil)
+			input    ReplyInput
+			uploader = &fakeUploader{err: errors.New("access denied")}
+			fn       = func(ctx context.Context, req *Request) (*Response, error) {
+				return &Response{PhysicalResourceId: "abc"}, nil
+			}
+		)
+
+		handler := New(fn, WithTransport(captureReply(t, &input)), WithOutput(buf), WithOutcomeArchive(uploader, "bucket", ""))
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := input.Status, StatusSuccess; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if !strings.Contains(buf.String(), "unable to archive outcome - access denied") {
+			t.Fatalf("got %v; want upload failure logged", buf.String())
+		}
+	})
+}
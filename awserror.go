@@ -0,0 +1,110 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// awsError matches errors returned by v1 of the AWS SDK, awserr.Error
+type awsError interface {
+	error
+	Code() string
+	Message() string
+}
+
+// apiError matches errors returned by v2 of the AWS SDK, smithy.APIError
+type apiError interface {
+	error
+	ErrorCode() string
+	ErrorMessage() string
+}
+
+var (
+	throttlingCodes = map[string]struct{}{
+		"Throttling":                             {},
+		"ThrottlingException":                    {},
+		"ThrottledException":                     {},
+		"TooManyRequestsException":               {},
+		"RequestLimitExceeded":                   {},
+		"RequestThrottled":                       {},
+		"SlowDown":                               {},
+		"ProvisionedThroughputExceededException": {},
+	}
+	accessDeniedCodes = map[string]struct{}{
+		"AccessDenied":                {},
+		"AccessDeniedException":       {},
+		"UnauthorizedOperation":       {},
+		"UnauthorizedAccess":          {},
+		"AuthorizationError":          {},
+		"AuthFailure":                 {},
+		"NotAuthorized":               {},
+		"InvalidClientTokenId":        {},
+		"UnrecognizedClientException": {},
+	}
+	notFoundCodes = map[string]struct{}{
+		"NotFound":                  {},
+		"NoSuchEntity":              {},
+		"NoSuchBucket":              {},
+		"NoSuchKey":                 {},
+		"ResourceNotFoundException": {},
+	}
+)
+
+// awsErrorCode returns the error code of an AWS SDK error, if any
+func awsErrorCode(err error) (code, message string, ok bool) {
+	var v1 awsError
+	if errors.As(err, &v1) {
+		return v1.Code(), v1.Message(), true
+	}
+
+	var v2 apiError
+	if errors.As(err, &v2) {
+		return v2.ErrorCode(), v2.ErrorMessage(), true
+	}
+
+	return "", "", false
+}
+
+// awsErrorReason returns a concise, actionable, reason for common AWS SDK
+// errors
+func awsErrorReason(err error) (string, bool) {
+	code, message, ok := awsErrorCode(err)
+	if !ok {
+		return "", false
+	}
+
+	if _, ok := throttlingCodes[code]; ok {
+		return fmt.Sprintf("request throttled by AWS (%v); please retry the stack operation", code), true
+	}
+	if _, ok := accessDeniedCodes[code]; ok {
+		return fmt.Sprintf("access denied (%v); check the Lambda execution role permissions: %v", code, message), true
+	}
+	if _, ok := notFoundCodes[code]; ok || strings.HasSuffix(code, "NotFound") {
+		return fmt.Sprintf("resource not found (%v): %v", code, message), true
+	}
+
+	return fmt.Sprintf("%v: %v", code, message), true
+}
+
+// WithAWSErrorReasons replaces the verbose reasons produced by AWS SDK errors
+// with concise, actionable ones.  The full error is still logged.
+func WithAWSErrorReasons() Option {
+	return func(o *options) {
+		o.awsErrorReasons = true
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// fakeAWSError mimics awserr.Error from v1 of the AWS SDK
+type fakeAWSError struct {
+	code    string
+	message string
+}
+
+func (f fakeAWSError) Error() string {
+	return fmt.Sprintf("%v: %v\n\tstatus code: 400, request id: 0123-4567", f.code, f.message)
+}
+func (f fakeAWSError) Code() string    { return f.code }
+func (f fakeAWSError) Message() string { return f.message }
+
+// fakeAPIError mimics smithy.APIError from v2 of the AWS SDK
+type fakeAPIError struct {
+	code    string
+	message string
+}
+
+func (f fakeAPIError) Error() string {
+	return fmt.Sprintf("operation error: https response error StatusCode: 400, api error %v: %v", f.code, f.message)
+}
+func (f fakeAPIError) ErrorCode() string    { return f.code }
+func (f fakeAPIError) ErrorMessage() string { return f.message }
+
+func TestWithAWSErrorReasons(t *testing.T) {
+	testCases := map[string]struct {
+		Err    error
+		Reason string
+	}{
+		"throttling": {
+			Err:    fakeAWSError{code: "ThrottlingException", message: "Rate exceeded"},
+			Reason: "request throttled by AWS (ThrottlingException); please retry the stack operation",
+		},
+		"access denied": {
+			Err:    fakeAPIError{code: "AccessDenied", message: "not authorized to perform s3:CreateBucket"},
+			Reason: "access denied (AccessDenied); check the Lambda execution role permissions: not authorized to perform s3:CreateBucket",
+		},
+		"not found wrapped": {
+			Err:    fmt.Errorf("unable to describe: %w", fakeAWSError{code: "InvalidVpcID.NotFound", message: "vpc-123 does not exist"}),
+			Reason: "resource not found (InvalidVpcID.NotFound): vpc-123 does not exist",
+		},
+		"other": {
+			Err:    fakeAWSError{code: "ValidationError", message: "bad input"},
+			Reason: "ValidationError: bad input",
+		},
+		"not aws": {
+			Err:    fmt.Errorf("boom"),
+			Reason: "boom",
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx   = context.Background()
+				buf   = bytes.NewBuffer(nil)
+				input ReplyInput
+				fn    = func(ctx context.Context, req *Request) (*Response, error) {
+					return nil, tc.Err
+				}
+			)
+
+			handler := New(fn, WithTransport(captureReply(t, &input)), WithOutput(buf), WithAWSErrorReasons())
+			if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Reason, tc.Reason; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if !strings.Contains(buf.String(), tc.Err.Error()) {
+				t.Fatalf("got %v; want full error logged", buf.String())
+			}
+		})
+	}
+}
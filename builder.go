@@ -0,0 +1,95 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"fmt"
+)
+
+// Builder assembles a Func from per request type callbacks e.g.
+//
+//	fn := new(customresource.Builder).
+//		OnCreate(create).
+//		OnUpdate(update).
+//		OnDelete(remove).
+//		Build()
+//
+// The zero value is ready to use.
+type Builder struct {
+	handlers map[string]Func
+}
+
+func (b *Builder) on(requestType string, fn Func) *Builder {
+	if b.handlers == nil {
+		b.handlers = map[string]Func{}
+	}
+	b.handlers[requestType] = fn
+	return b
+}
+
+// OnCreate registers fn to handle Create requests
+func (b *Builder) OnCreate(fn Func) *Builder {
+	return b.on(RequestTypeCreate, fn)
+}
+
+// OnCreateIdempotent registers a Create handler with create-if-not-exists
+// semantics.  find is called first; if it reports the resource already exists,
+// its Response is returned and create is not called.  Otherwise create runs.
+// This makes a retried or replayed Create safe.
+func (b *Builder) OnCreateIdempotent(find func(ctx context.Context, req *Request) (*Response, bool, error), create Func) *Builder {
+	return b.on(RequestTypeCreate, func(ctx context.Context, req *Request) (*Response, error) {
+		resp, ok, err := find(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("unable to find existing resource: %w", err)
+		}
+		if ok {
+			TraceRoute(ctx, "found("+funcName(find)+")")
+			return resp, nil
+		}
+		TraceRoute(ctx, "create("+funcName(create)+")")
+		return create(ctx, req)
+	})
+}
+
+// OnUpdate registers fn to handle Update requests
+func (b *Builder) OnUpdate(fn Func) *Builder {
+	return b.on(RequestTypeUpdate, fn)
+}
+
+// OnDelete registers fn to handle Delete requests
+func (b *Builder) OnDelete(fn Func) *Builder {
+	return b.on(RequestTypeDelete, fn)
+}
+
+// Build returns a Func that dispatches each request to the callback
+// registered for its request type.  Requests for a type without a callback
+// fail with a descriptive error.  Later registrations do not affect Funcs
+// already built.
+func (b *Builder) Build() Func {
+	handlers := make(map[string]Func, len(b.handlers))
+	for k, v := range b.handlers {
+		handlers[k] = v
+	}
+
+	return func(ctx context.Context, req *Request) (*Response, error) {
+		fn, ok := handlers[req.RequestType]
+		if !ok || fn == nil {
+			return nil, fmt.Errorf("no handler registered for %v requests of %v", req.RequestType, req.ResourceType)
+		}
+		TraceRoute(ctx, "Builder.On"+req.RequestType+"("+funcName(fn)+")")
+		return fn(ctx, req)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	respond := func(id string) Func {
+		return func(ctx context.Context, req *Request) (*Response, error) {
+			return &Response{PhysicalResourceId: id}, nil
+		}
+	}
+
+	fn := new(Builder).
+		OnCreate(respond("created")).
+		OnUpdate(respond("updated")).
+		OnDelete(respond("deleted")).
+		Build()
+
+	testCases := map[string]struct {
+		Fn          Func
+		RequestType string
+		Status      string
+		Want        string
+	}{
+		"create": {
+			Fn:          fn,
+			RequestType: RequestTypeCreate,
+			Status:      StatusSuccess,
+			Want:        "created",
+		},
+		"update": {
+			Fn:          fn,
+			RequestType: RequestTypeUpdate,
+			Status:      StatusSuccess,
+			Want:        "updated",
+		},
+		"delete": {
+			Fn:          fn,
+			RequestType: RequestTypeDelete,
+			Status:      StatusSuccess,
+			Want:        "deleted",
+		},
+		"unregistered": {
+			Fn:          new(Builder).OnCreate(respond("created")).Build(),
+			RequestType: RequestTypeDelete,
+			Status:      StatusFailed,
+			Want:        "no handler registered for Delete requests of Custom::Widget",
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx   = context.Background()
+				input ReplyInput
+			)
+
+			handler := New(tc.Fn, WithTransport(captureReply(t, &input)))
+			data := marshalRequest(t, Request{RequestType: tc.RequestType, ResourceType: "Custom::Widget", PhysicalResourceId: "abc"})
+			if _, err := handler.Invoke(ctx, data); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Status, tc.Status; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+
+			got := input.PhysicalResourceId
+			if tc.Status == StatusFailed {
+				got = input.Reason
+			}
+			if got != tc.Want {
+				t.Fatalf("got %v; want %v", got, tc.Want)
+			}
+		})
+	}
+}
+
+func TestBuilder_OnCreateIdempotent(t *testing.T) {
+	testCases := map[string]struct {
+		Exists  bool
+		FindErr error
+		Status  string
+		Want    string
+		Created bool
+	}{
+		"exists": {
+			Exists: true,
+			Status: StatusSuccess,
+			Want:   "existing",
+		},
+		"not exists": {
+			Status:  StatusSuccess,
+			Want:    "created",
+			Created: true,
+		},
+		"find error": {
+			FindErr: errors.New("boom"),
+			Status:  StatusFailed,
+			Want:    "unable to find existing resource: boom",
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx     = context.Background()
+				input   ReplyInput
+				created bool
+				find    = func(ctx context.Context, req *Request) (*Response, bool, error) {
+					if tc.FindErr != nil {
+						return nil, false, tc.FindErr
+					}
+					if !tc.Exists {
+						return nil, false, nil
+					}
+					return &Response{PhysicalResourceId: "existing"}, true, nil
+				}
+				create = func(ctx context.Context, req *Request) (*Response, error) {
+					created = true
+					return &Response{PhysicalResourceId: "created"}, nil
+				}
+			)
+
+			fn := new(Builder).OnCreateIdempotent(find, create).Build()
+			handler := New(fn, WithTransport(captureReply(t, &input)))
+			if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Status, tc.Status; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			got := input.PhysicalResourceId
+			if tc.Status == StatusFailed {
+				got = input.Reason
+			}
+			if want := tc.Want; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := created, tc.Created; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
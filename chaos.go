@@ -0,0 +1,104 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrChaos is returned for failures injected by WithChaos
+var ErrChaos = errors.New("chaos: injected failure")
+
+// ChaosConfig configures the faults injected by WithChaos.
+//
+// NOT FOR PRODUCTION USE.  Chaos is intended to exercise timeout and retry
+// behavior in test and staging environments only.
+type ChaosConfig struct {
+	// LatencyProbability is the probability, between 0 and 1, that Latency is injected
+	LatencyProbability float64
+	// Latency is the delay injected
+	Latency time.Duration
+	// FailureProbability is the probability, between 0 and 1, that ErrChaos is returned
+	FailureProbability float64
+	// Handler additionally injects latency and failures prior to calling the Func
+	Handler bool
+	// Rand optionally provides the random values used; defaults to math/rand
+	Rand func() float64
+}
+
+type chaos struct {
+	ChaosConfig
+	mutex sync.Mutex
+}
+
+func newChaos(config ChaosConfig, random *rand.Rand) *chaos {
+	if config.Rand == nil {
+		if random == nil {
+			random = rand.New(rand.NewSource(time.Now().UnixNano()))
+		}
+		config.Rand = random.Float64
+	}
+	return &chaos{ChaosConfig: config}
+}
+
+func (c *chaos) roll(probability float64) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.Rand() < probability
+}
+
+// inject sleeps and/or fails per the configured probabilities
+func (c *chaos) inject(ctx context.Context) error {
+	if c.roll(c.LatencyProbability) {
+		timer := time.NewTimer(c.Latency)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	if c.roll(c.FailureProbability) {
+		return ErrChaos
+	}
+
+	return nil
+}
+
+type chaosTransport struct {
+	chaos     *chaos
+	transport http.RoundTripper
+}
+
+func (c chaosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := c.chaos.inject(req.Context()); err != nil {
+		return nil, err
+	}
+	return c.transport.RoundTrip(req)
+}
+
+// WithChaos injects latency and failures into the reply transport and,
+// optionally, the Func.  NOT FOR PRODUCTION USE.
+func WithChaos(config ChaosConfig) Option {
+	return func(o *options) {
+		o.chaos = &config
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// sequence returns the provided values in order, repeating the last
+func sequence(values ...float64) func() float64 {
+	return func() float64 {
+		v := values[0]
+		if len(values) > 1 {
+			values = values[1:]
+		}
+		return v
+	}
+}
+
+func TestWithChaos(t *testing.T) {
+	fn := func(ctx context.Context, req *Request) (*Response, error) {
+		return &Response{PhysicalResourceId: "abc"}, nil
+	}
+
+	t.Run("transport failure", func(t *testing.T) {
+		var (
+			ctx   = context.Background()
+			input ReplyInput
+		)
+
+		handler := New(fn,
+			WithTransport(captureReply(t, &input)),
+			WithChaos(ChaosConfig{FailureProbability: 1}),
+		)
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != ErrChaos {
+			t.Fatalf("got %v; want %v", err, ErrChaos)
+		}
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		var (
+			ctx     = context.Background()
+			input   ReplyInput
+			latency = 10 * time.Millisecond
+		)
+
+		handler := New(fn,
+			WithTransport(captureReply(t, &input)),
+			WithChaos(ChaosConfig{LatencyProbability: 1, Latency: latency}),
+		)
+
+		started := time.Now()
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got := time.Since(started); got < latency {
+			t.Fatalf("got %v; want at least %v", got, latency)
+		}
+		if got, want := input.Status, StatusSuccess; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("handler failure retried", func(t *testing.T) {
+		var (
+			ctx   = context.Background()
+			input ReplyInput
+			calls int
+			fn    = func(ctx context.Context, req *Request) (*Response, error) {
+				calls++
+				return &Response{PhysicalResourceId: req.PhysicalResourceId}, nil
+			}
+			isBusy = func(err error) bool { return err == ErrChaos }
+		)
+
+		// rolls alternate latency, failure; the first handler attempt fails
+		handler := New(fn,
+			WithTransport(captureReply(t, &input)),
+			WithDeleteRetryWhile(isBusy, 3, time.Millisecond),
+			WithChaos(ChaosConfig{
+				FailureProbability: 0.5,
+				Handler:            true,
+				Rand:               sequence(0.9, 0.1, 0.9, 0.9),
+			}),
+		)
+		data := marshalRequest(t, Request{RequestType: RequestTypeDelete, PhysicalResourceId: "abc"})
+		if _, err := handler.Invoke(ctx, data); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := calls, 1; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := input.Status, StatusSuccess; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+}
@@ -0,0 +1,167 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock only advances when told to
+type fakeClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	until time.Time
+	ch    chan time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.now
+}
+
+func (f *fakeClock) After(d time.Duration) <-chan time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- f.now
+		return ch
+	}
+	f.waiters = append(f.waiters, fakeWaiter{until: f.now.Add(d), ch: ch})
+	return ch
+}
+
+func (f *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-f.After(d):
+		return nil
+	}
+}
+
+// Advance moves the clock forward by d, firing any waiters that are due
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.now = f.now.Add(d)
+
+	var pending []fakeWaiter
+	for _, w := range f.waiters {
+		if w.until.After(f.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.ch <- f.now
+	}
+	f.waiters = pending
+}
+
+// BlockUntil waits until n callers are waiting on the clock
+func (f *fakeClock) BlockUntil(n int) {
+	for {
+		f.mutex.Lock()
+		waiting := len(f.waiters)
+		f.mutex.Unlock()
+
+		if waiting >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	t.Run("watchdog", func(t *testing.T) {
+		var (
+			now         = time.Now()
+			clk         = &fakeClock{now: now}
+			ctx, cancel = context.WithDeadline(context.Background(), now.Add(time.Hour))
+			input       ReplyInput
+			fn          = func(ctx context.Context, req *Request) (*Response, error) {
+				<-ctx.Done()
+				return &Response{PhysicalResourceId: "abc"}, nil
+			}
+			handler = New(fn, WithTransport(captureReply(t, &input)), withClock(clk))
+		)
+		defer cancel()
+
+		go func() {
+			clk.BlockUntil(1)
+			clk.Advance(54 * time.Minute)
+		}()
+
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := input.Status, StatusFailed; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := input.Reason, "handler timed out"; !strings.HasPrefix(got, want) {
+			t.Fatalf("got %v; want prefix %v", got, want)
+		}
+		// the Func may yet create the resource so the rollback Delete must call it
+		if got := input.PhysicalResourceId; neverCreated(got) {
+			t.Fatalf("got %v; want an id the rollback Delete is not skipped for", got)
+		}
+	})
+
+	t.Run("backoff", func(t *testing.T) {
+		var (
+			ctx           = context.Background()
+			clk           = &fakeClock{now: time.Unix(1550000000, 0)}
+			calls         int
+			errDependency = errors.New("DependencyViolation")
+			fn            = func(ctx context.Context, req *Request) (*Response, error) {
+				calls++
+				if calls == 1 {
+					return nil, errDependency
+				}
+				return &Response{PhysicalResourceId: "abc"}, nil
+			}
+			input   ReplyInput
+			isBusy  = func(err error) bool { return err == errDependency }
+			handler = New(fn, WithTransport(captureReply(t, &input)), WithDeleteRetryWhile(isBusy, 2, time.Hour), withClock(clk))
+		)
+
+		go func() {
+			clk.BlockUntil(1)
+			clk.Advance(time.Hour)
+		}()
+
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeDelete, PhysicalResourceId: "abc"})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := calls, 2; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := input.Status, StatusSuccess; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+}
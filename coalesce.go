@@ -0,0 +1,112 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// coalescer collapses consecutive identical lines written to w into a single
+// line with a count suffix e.g. "retrying (x5)".  The most recent line is
+// held until a different line is written or Flush is called.
+type coalescer struct {
+	mutex   sync.Mutex
+	w       io.Writer
+	partial []byte
+	last    []byte
+	count   int
+}
+
+func newCoalescer(w io.Writer) *coalescer {
+	return &coalescer{w: w}
+}
+
+// Write implements io.Writer
+func (c *coalescer) Write(p []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.partial = append(c.partial, p...)
+	for {
+		i := bytes.IndexByte(c.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := c.partial[:i]
+		if c.count > 0 && bytes.Equal(line, c.last) {
+			c.count++
+		} else {
+			if err := c.writeLast(); err != nil {
+				return 0, err
+			}
+			c.last = append(c.last[:0], line...)
+			c.count = 1
+		}
+		c.partial = c.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// writeLast writes the held line, if any
+func (c *coalescer) writeLast() error {
+	if c.count == 0 {
+		return nil
+	}
+
+	var err error
+	if c.count > 1 {
+		_, err = fmt.Fprintf(c.w, "%s (x%d)\n", c.last, c.count)
+	} else {
+		_, err = fmt.Fprintf(c.w, "%s\n", c.last)
+	}
+	c.count = 0
+	return err
+}
+
+// Flush writes any held output
+func (c *coalescer) Flush() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.writeLast(); err != nil {
+		return err
+	}
+	if len(c.partial) > 0 {
+		if _, err := c.w.Write(c.partial); err != nil {
+			return err
+		}
+		c.partial = nil
+	}
+	return nil
+}
+
+// flushLogs writes any output held by WithCoalesceLogs
+func (h *Handler) flushLogs() {
+	for _, c := range h.coalescers {
+		c.Flush()
+	}
+}
+
+// WithCoalesceLogs collapses consecutive identical log lines into a single
+// line with a count suffix e.g. "[WARN] Resource: Delete busy ... (x5)".
+// Held lines are written no later than the end of each invocation.
+func WithCoalesceLogs() Option {
+	return func(o *options) {
+		o.coalesceLogs = true
+	}
+}
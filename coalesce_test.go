@@ -0,0 +1,97 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCoalescer(t *testing.T) {
+	testCases := map[string]struct {
+		Writes []string
+		Want   string
+	}{
+		"distinct": {
+			Writes: []string{"a\n", "b\n", "c\n"},
+			Want:   "a\nb\nc\n",
+		},
+		"repeated": {
+			Writes: []string{"a\n", "a\n", "a\n", "b\n", "a\n"},
+			Want:   "a (x3)\nb\na\n",
+		},
+		"split writes": {
+			Writes: []string{"a", "\na\n", "a\nb"},
+			Want:   "a (x3)\nb",
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			c := newCoalescer(buf)
+			for _, w := range tc.Writes {
+				if _, err := c.Write([]byte(w)); err != nil {
+					t.Fatalf("got %v; want nil", err)
+				}
+			}
+			if err := c.Flush(); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := buf.String(), tc.Want; got != want {
+				t.Fatalf("got %q; want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestWithCoalesceLogs(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		errBusy = errors.New("busy")
+		fn      = func(ctx context.Context, req *Request) (*Response, error) {
+			return nil, errBusy
+		}
+		isBusy = func(err error) bool { return err == errBusy }
+		data   = []byte(`{"RequestType":"Delete","LogicalResourceId":"Resource","ResponseURL":"http://localhost"}`)
+	)
+
+	buf := bytes.NewBuffer(nil)
+	handler := New(fn, WithTransport(okTransport{}), WithOutput(buf), WithDeleteRetryWhile(isBusy, 4, 0), WithCoalesceLogs())
+	if _, err := handler.Invoke(ctx, data); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := buf.String(), "[WARN] Resource: Delete busy, retrying in 0s - busy (x3)\n"; !strings.Contains(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := strings.Count(buf.String(), "busy, retrying"), 1; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if !strings.Contains(buf.String(), "[ERROR] Resource: Delete failed - busy\n") {
+		t.Fatalf("got %v; want failure flushed", buf.String())
+	}
+
+	buf.Reset()
+	handler = New(fn, WithTransport(okTransport{}), WithOutput(buf), WithDeleteRetryWhile(isBusy, 4, 0))
+	if _, err := handler.Invoke(ctx, data); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := strings.Count(buf.String(), "busy, retrying"), 3; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
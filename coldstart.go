@@ -0,0 +1,37 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"sync/atomic"
+)
+
+// warm is set once the first invocation in the process has started
+var warm int32
+
+// takeColdStart returns true for the first invocation in the process, i.e.
+// the first in the Lambda container, and false thereafter
+func takeColdStart() bool {
+	return atomic.CompareAndSwapInt32(&warm, 0, 1)
+}
+
+// WithColdStart flags the first invocation in a Lambda container.  The cold
+// start is logged and the time_to_reply metric gains a coldStart label, true
+// or false, so cold start latency can be told apart.
+func WithColdStart() Option {
+	return func(o *options) {
+		o.coldStart = true
+	}
+}
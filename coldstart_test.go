@@ -0,0 +1,57 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWithColdStart(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		input     ReplyInput
+		buf       = &bytes.Buffer{}
+		collector = &fakeCollector{}
+		fn        = func(ctx context.Context, req *Request) (*Response, error) {
+			return &Response{PhysicalResourceId: "abc"}, nil
+		}
+	)
+
+	atomic.StoreInt32(&warm, 0)
+	handler := New(fn, WithTransport(captureReply(t, &input)), WithOutput(buf), WithMetricsCollector(collector), WithColdStart())
+	for _, want := range []bool{true, false, false} {
+		buf.Reset()
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate, LogicalResourceId: "Resource"})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got := strings.Contains(buf.String(), "Resource: Create coldStart=true"); got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	}
+
+	labels := collector.labels[metricTimeToReply]
+	if got, want := len(labels), 3; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	for i, want := range []string{"true", "false", "false"} {
+		if got := labels[i]["coldStart"]; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresourcetest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// StackEvent describes a CloudFormation stack event
+type StackEvent struct {
+	LogicalResourceId    string
+	PhysicalResourceId   string
+	ResourceStatus       string
+	ResourceStatusReason string
+	Timestamp            time.Time
+}
+
+// StackEventsClient retrieves the events of a stack.  Typically an adapter
+// around the DescribeStackEvents api of the AWS SDK.
+type StackEventsClient interface {
+	DescribeStackEvents(ctx context.Context, stackId string) ([]StackEvent, error)
+}
+
+// isTerminal returns true for resource statuses that are not in progress
+func isTerminal(status string) bool {
+	return strings.HasSuffix(status, "_COMPLETE") || strings.HasSuffix(status, "_FAILED")
+}
+
+// latest returns the most recent event for logicalId
+func latest(events []StackEvent, logicalId string) (StackEvent, bool) {
+	var (
+		found bool
+		event StackEvent
+	)
+	for _, e := range events {
+		if e.LogicalResourceId != logicalId {
+			continue
+		}
+		if !found || e.Timestamp.After(event.Timestamp) {
+			event, found = e, true
+		}
+	}
+	return event, found
+}
+
+// AwaitResourceStatus polls the stack events until the resource, logicalId,
+// reaches a terminal state e.g. CREATE_COMPLETE or UPDATE_FAILED, and returns
+// the corresponding event.  Intended for integration tests against real
+// stacks to confirm the reply was delivered and accepted by CloudFormation.
+func AwaitResourceStatus(ctx context.Context, client StackEventsClient, stackId, logicalId string, timeout time.Duration) (StackEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	interval := timeout / 10
+	if interval > 5*time.Second {
+		interval = 5 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last StackEvent
+	for {
+		events, err := client.DescribeStackEvents(ctx, stackId)
+		if err != nil {
+			return StackEvent{}, fmt.Errorf("unable to describe events for stack, %v: %v", stackId, err)
+		}
+		if event, ok := latest(events, logicalId); ok {
+			if isTerminal(event.ResourceStatus) {
+				return event, nil
+			}
+			last = event
+		}
+
+		select {
+		case <-ctx.Done():
+			return last, fmt.Errorf("timed out waiting for %v to reach a terminal state; last status %q", logicalId, last.ResourceStatus)
+		case <-ticker.C:
+		}
+	}
+}
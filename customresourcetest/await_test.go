@@ -0,0 +1,99 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresourcetest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeEvents returns successive batches of events on each call
+type fakeEvents struct {
+	mutex   sync.Mutex
+	batches [][]StackEvent
+	err     error
+}
+
+func (f *fakeEvents) DescribeStackEvents(ctx context.Context, stackId string) ([]StackEvent, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.err != nil {
+		return nil, f.err
+	}
+	events := f.batches[0]
+	if len(f.batches) > 1 {
+		f.batches = f.batches[1:]
+	}
+	return events, nil
+}
+
+func TestAwaitResourceStatus(t *testing.T) {
+	var (
+		ctx = context.Background()
+		t0  = time.Unix(1550000000, 0)
+	)
+
+	t.Run("complete", func(t *testing.T) {
+		client := &fakeEvents{
+			batches: [][]StackEvent{
+				{
+					{LogicalResourceId: "Resource", ResourceStatus: "CREATE_IN_PROGRESS", Timestamp: t0},
+				},
+				{
+					{LogicalResourceId: "Resource", ResourceStatus: "CREATE_COMPLETE", Timestamp: t0.Add(time.Second)},
+					{LogicalResourceId: "Other", ResourceStatus: "CREATE_IN_PROGRESS", Timestamp: t0.Add(2 * time.Second)},
+					{LogicalResourceId: "Resource", ResourceStatus: "CREATE_IN_PROGRESS", Timestamp: t0},
+				},
+			},
+		}
+
+		event, err := AwaitResourceStatus(ctx, client, StackId, "Resource", time.Second)
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := event.ResourceStatus, "CREATE_COMPLETE"; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		client := &fakeEvents{
+			batches: [][]StackEvent{
+				{
+					{LogicalResourceId: "Resource", ResourceStatus: "CREATE_IN_PROGRESS", Timestamp: t0},
+				},
+			},
+		}
+
+		event, err := AwaitResourceStatus(ctx, client, StackId, "Resource", 50*time.Millisecond)
+		if err == nil {
+			t.Fatalf("got nil; want err")
+		}
+		if got, want := event.ResourceStatus, "CREATE_IN_PROGRESS"; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("client error", func(t *testing.T) {
+		client := &fakeEvents{err: errors.New("access denied")}
+		if _, err := AwaitResourceStatus(ctx, client, StackId, "Resource", time.Second); err == nil {
+			t.Fatalf("got nil; want err")
+		}
+	})
+}
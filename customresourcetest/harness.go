@@ -0,0 +1,99 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresourcetest
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/savaki/customresource"
+)
+
+// Run dispatches req to handler and returns the reply that would have been
+// sent to the ResponseURL, no transport required e.g.
+//
+//	reply := customresourcetest.Run(t, handler, customresourcetest.NewRequest(customresource.RequestTypeCreate, props))
+//	customresourcetest.AssertSuccess(t, reply)
+//	customresourcetest.DataEquals(t, reply, map[string]interface{}{"Arn": "arn:aws:s3:::blue"})
+//
+// Run fails the test, and returns nil, if the request was rejected without a
+// reply.
+func Run(tt TestingT, handler *customresource.Handler, req *customresource.Request) *customresource.ReplyInput {
+	tt.Helper()
+
+	reply, err := handler.Dispatch(context.Background(), req)
+	if err != nil {
+		tt.Errorf("%v rejected: %v", req.RequestType, err)
+		return nil
+	}
+	return reply
+}
+
+// AssertSuccess fails the test unless reply is SUCCESS
+func AssertSuccess(tt TestingT, reply *customresource.ReplyInput) {
+	tt.Helper()
+
+	if reply == nil {
+		tt.Errorf("got no reply; want %v", customresource.StatusSuccess)
+		return
+	}
+	if reply.Status != customresource.StatusSuccess {
+		tt.Errorf("got %v, %v; want %v", reply.Status, reply.Reason, customresource.StatusSuccess)
+	}
+}
+
+// AssertFailed fails the test unless reply is FAILED with a reason containing
+// reason.  Use an empty reason to accept any.
+func AssertFailed(tt TestingT, reply *customresource.ReplyInput, reason string) {
+	tt.Helper()
+
+	if reply == nil {
+		tt.Errorf("got no reply; want %v", customresource.StatusFailed)
+		return
+	}
+	if reply.Status != customresource.StatusFailed {
+		tt.Errorf("got %v; want %v", reply.Status, customresource.StatusFailed)
+		return
+	}
+	if !strings.Contains(reply.Reason, reason) {
+		tt.Errorf("got reason %q; want %q", reply.Reason, reason)
+	}
+}
+
+// DataEquals fails the test unless the Data of reply, as CloudFormation would
+// receive it, equals want
+func DataEquals(tt TestingT, reply *customresource.ReplyInput, want map[string]interface{}) {
+	tt.Helper()
+
+	if reply == nil {
+		tt.Errorf("got no reply; want Data %v", want)
+		return
+	}
+
+	got, err := dataMap(reply.Data)
+	if err != nil {
+		tt.Errorf("unable to read Data: %v", err)
+		return
+	}
+	expected, err := dataMap(want)
+	if err != nil {
+		tt.Errorf("unable to read expected Data: %v", err)
+		return
+	}
+	if !reflect.DeepEqual(got, expected) {
+		tt.Errorf("got Data %v; want %v", got, expected)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresourcetest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/savaki/customresource"
+)
+
+func TestHarness(t *testing.T) {
+	fn := func(ctx context.Context, req *customresource.Request) (*customresource.Response, error) {
+		if req.RequestType == customresource.RequestTypeDelete {
+			return nil, errors.New("bucket not empty")
+		}
+		return &customresource.Response{
+			PhysicalResourceId: "blue",
+			Data:               map[string]interface{}{"Arn": "arn:aws:s3:::blue", "Count": 2},
+		}, nil
+	}
+	handler := customresource.New(fn)
+
+	testCases := map[string]struct {
+		RequestType string
+		Assert      func(TestingT, *customresource.ReplyInput)
+		Errors      []string
+	}{
+		"success": {
+			RequestType: customresource.RequestTypeCreate,
+			Assert:      AssertSuccess,
+		},
+		"not success": {
+			RequestType: customresource.RequestTypeDelete,
+			Assert:      AssertSuccess,
+			Errors:      []string{"got FAILED, bucket not empty; want SUCCESS"},
+		},
+		"failed": {
+			RequestType: customresource.RequestTypeDelete,
+			Assert: func(tt TestingT, reply *customresource.ReplyInput) {
+				AssertFailed(tt, reply, "not empty")
+			},
+		},
+		"failed reason": {
+			RequestType: customresource.RequestTypeDelete,
+			Assert: func(tt TestingT, reply *customresource.ReplyInput) {
+				AssertFailed(tt, reply, "access denied")
+			},
+			Errors: []string{`got reason "bucket not empty"; want "access denied"`},
+		},
+		"not failed": {
+			RequestType: customresource.RequestTypeCreate,
+			Assert: func(tt TestingT, reply *customresource.ReplyInput) {
+				AssertFailed(tt, reply, "")
+			},
+			Errors: []string{"got SUCCESS; want FAILED"},
+		},
+		"data": {
+			RequestType: customresource.RequestTypeCreate,
+			Assert: func(tt TestingT, reply *customresource.ReplyInput) {
+				DataEquals(tt, reply, map[string]interface{}{"Arn": "arn:aws:s3:::blue", "Count": 2})
+			},
+		},
+		"data differs": {
+			RequestType: customresource.RequestTypeCreate,
+			Assert: func(tt TestingT, reply *customresource.ReplyInput) {
+				DataEquals(tt, reply, map[string]interface{}{"Arn": "arn:aws:s3:::green", "Count": 2})
+			},
+			Errors: []string{"got Data map[Arn:arn:aws:s3:::blue Count:2]; want map[Arn:arn:aws:s3:::green Count:2]"},
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			reply := Run(t, handler, NewRequest(tc.RequestType, nil))
+
+			r := &recorder{}
+			tc.Assert(r, reply)
+			if got, want := r.errors, tc.Errors; !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+
+	t.Run("rejected", func(t *testing.T) {
+		handler := customresource.New(fn, customresource.WithRequireTLS())
+		req := NewRequest(customresource.RequestTypeCreate, nil)
+		req.ResponseURL = "http://localhost"
+
+		r := &recorder{}
+		if reply := Run(r, handler, req); reply != nil {
+			t.Fatalf("got %v; want nil", reply)
+		}
+		if got, want := len(r.errors), 1; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+}
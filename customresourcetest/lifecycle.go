@@ -0,0 +1,94 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresourcetest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/savaki/customresource"
+)
+
+// LifecycleResult holds the reply sent at each stage of a Lifecycle; stages
+// not reached are nil
+type LifecycleResult struct {
+	Create *customresource.ReplyInput
+	Update *customresource.ReplyInput
+	Delete *customresource.ReplyInput
+}
+
+// Lifecycle exercises fn through Create, Update, and Delete, passing the
+// PhysicalResourceId from each reply to the next stage.  Lifecycle stops at,
+// and returns an error for, the first stage that does not reply SUCCESS.
+//
+// ctx is passed through to fn unchanged so a test may pre-populate it with
+// fakes of the AWS config or clients the Func reads from its context, e.g.
+//
+//	ctx := context.WithValue(context.Background(), clientKey{}, &fakeS3{})
+//	result, err := customresourcetest.Lifecycle(ctx, fn, createProps, updateProps)
+//
+// allowing the full lifecycle to run offline.  opts configure the Handler;
+// the Transport is always provided by Lifecycle.
+func Lifecycle(ctx context.Context, fn customresource.Func, createProps, updateProps interface{}, opts ...customresource.Option) (LifecycleResult, error) {
+	var (
+		result    LifecycleResult
+		transport = NewTransport()
+		options   = append(append([]customresource.Option(nil), opts...), customresource.WithTransport(transport))
+		handler   = customresource.New(fn, options...)
+	)
+
+	stage := func(requestType string, props, oldProps interface{}, physicalID string) (*customresource.ReplyInput, error) {
+		req := NewRequest(requestType, props)
+		req.PhysicalResourceId = physicalID
+		if oldProps != nil {
+			data, err := encodeProps(oldProps)
+			if err != nil {
+				return nil, fmt.Errorf("customresourcetest: %v", err)
+			}
+			req.OldResourceProperties = data
+		}
+
+		payload, err := json.Marshal(req)
+		if err != nil {
+			return nil, fmt.Errorf("customresourcetest: unable to encode request: %v", err)
+		}
+		before := transport.Reply()
+		if _, err := handler.Invoke(ctx, payload); err != nil {
+			return nil, fmt.Errorf("customresourcetest: %v failed - %v", requestType, err)
+		}
+
+		reply := transport.Reply()
+		if reply == nil || (before != nil && reply.RequestId == before.RequestId) {
+			return nil, fmt.Errorf("customresourcetest: %v sent no reply", requestType)
+		}
+		if reply.Status != customresource.StatusSuccess {
+			return reply, fmt.Errorf("customresourcetest: %v failed - %v", requestType, reply.Reason)
+		}
+		return reply, nil
+	}
+
+	var err error
+	if result.Create, err = stage(customresource.RequestTypeCreate, createProps, nil, ""); err != nil {
+		return result, err
+	}
+	if result.Update, err = stage(customresource.RequestTypeUpdate, updateProps, createProps, result.Create.PhysicalResourceId); err != nil {
+		return result, err
+	}
+	if result.Delete, err = stage(customresource.RequestTypeDelete, updateProps, nil, result.Update.PhysicalResourceId); err != nil {
+		return result, err
+	}
+	return result, nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresourcetest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/savaki/customresource"
+)
+
+// bucketAPI is the subset of an S3 client used by the example handler
+type bucketAPI interface {
+	CreateBucket(ctx context.Context, name string) error
+	DeleteBucket(ctx context.Context, name string) error
+}
+
+type bucketAPIKey struct{}
+
+// bucketHandler is an example Func that reads its AWS client from ctx
+func bucketHandler(ctx context.Context, req *customresource.Request) (*customresource.Response, error) {
+	client, ok := ctx.Value(bucketAPIKey{}).(bucketAPI)
+	if !ok {
+		return nil, errors.New("no bucket client configured")
+	}
+
+	var props struct {
+		BucketName string
+	}
+	if err := json.Unmarshal(req.ResourceProperties, &props); err != nil {
+		return nil, err
+	}
+
+	switch req.RequestType {
+	case customresource.RequestTypeCreate:
+		if err := client.CreateBucket(ctx, props.BucketName); err != nil {
+			return nil, err
+		}
+		return &customresource.Response{PhysicalResourceId: props.BucketName}, nil
+
+	case customresource.RequestTypeUpdate:
+		if props.BucketName == req.PhysicalResourceId {
+			return &customresource.Response{PhysicalResourceId: req.PhysicalResourceId}, nil
+		}
+		if err := client.CreateBucket(ctx, props.BucketName); err != nil {
+			return nil, err
+		}
+		return &customresource.Response{PhysicalResourceId: props.BucketName}, nil
+
+	default:
+		if err := client.DeleteBucket(ctx, req.PhysicalResourceId); err != nil {
+			return nil, err
+		}
+		return &customresource.Response{PhysicalResourceId: req.PhysicalResourceId}, nil
+	}
+}
+
+type fakeBuckets struct {
+	calls []string
+	err   error
+}
+
+func (f *fakeBuckets) CreateBucket(ctx context.Context, name string) error {
+	f.calls = append(f.calls, "create "+name)
+	return f.err
+}
+
+func (f *fakeBuckets) DeleteBucket(ctx context.Context, name string) error {
+	f.calls = append(f.calls, "delete "+name)
+	return f.err
+}
+
+func TestLifecycle(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var (
+			fake = &fakeBuckets{}
+			ctx  = context.WithValue(context.Background(), bucketAPIKey{}, bucketAPI(fake))
+		)
+
+		result, err := Lifecycle(ctx, bucketHandler,
+			map[string]string{"BucketName": "blue"},
+			map[string]string{"BucketName": "green"},
+		)
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := result.Create.PhysicalResourceId, "blue"; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := result.Update.PhysicalResourceId, "green"; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := result.Delete.Status, customresource.StatusSuccess; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := strings.Join(fake.calls, ","), "create blue,create green,delete green"; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		var (
+			fake = &fakeBuckets{err: errors.New("AccessDenied")}
+			ctx  = context.WithValue(context.Background(), bucketAPIKey{}, bucketAPI(fake))
+		)
+
+		result, err := Lifecycle(ctx, bucketHandler,
+			map[string]string{"BucketName": "blue"},
+			map[string]string{"BucketName": "green"},
+		)
+		if err == nil {
+			t.Fatalf("got nil; want error")
+		}
+		if got, want := result.Create.Status, customresource.StatusFailed; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if result.Update != nil || result.Delete != nil {
+			t.Fatalf("got %v; want later stages skipped", result)
+		}
+	})
+
+	t.Run("no fake", func(t *testing.T) {
+		if _, err := Lifecycle(context.Background(), bucketHandler, nil, nil); err == nil {
+			t.Fatalf("got nil; want error")
+		}
+	})
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package customresourcetest provides helpers for testing custom resources
+package customresourcetest
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+
+	"github.com/savaki/customresource"
+)
+
+const (
+	// StackId used by NewRequest
+	StackId = "arn:aws:cloudformation:us-east-1:123456789012:stack/test-stack/3e2c7f00-4b5a-11e9-8f6e-0a1b2c3d4e5f"
+	// LogicalResourceId used by NewRequest
+	LogicalResourceId = "TestResource"
+	// PhysicalResourceId used by NewRequest for Update and Delete requests
+	PhysicalResourceId = "test-physical-id"
+	// ResourceType used by NewRequest
+	ResourceType = "Custom::Test"
+	// ResponseURL used by NewRequest; replies should be captured via a transport
+	ResponseURL = "https://cloudformation-custom-resource-response-useast1.s3.amazonaws.com/test"
+	// ServiceToken added to the ResourceProperties by NewRequest; the arn of
+	// the function under test
+	ServiceToken = "arn:aws:lambda:us-east-1:123456789012:function:test-function"
+)
+
+// newRequestId returns a random, uuid formatted, request id
+func newRequestId() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// NewRequest returns a valid Request of the specified type with props, json
+// encoded, as its ResourceProperties.  As with CloudFormation, the
+// ResourceProperties include the ServiceToken.  NewRequest panics if props
+// cannot be encoded as a json object.
+func NewRequest(requestType string, props interface{}) *customresource.Request {
+	req := &customresource.Request{
+		RequestType:       requestType,
+		ResponseURL:       ResponseURL,
+		StackId:           StackId,
+		RequestId:         newRequestId(),
+		ResourceType:      ResourceType,
+		LogicalResourceId: LogicalResourceId,
+	}
+	if requestType != customresource.RequestTypeCreate {
+		req.PhysicalResourceId = PhysicalResourceId
+	}
+
+	data, err := encodeProps(props)
+	if err != nil {
+		panic(err)
+	}
+	req.ResourceProperties = data
+
+	return req
+}
+
+// encodeProps returns props, json encoded, with the ServiceToken added
+func encodeProps(props interface{}) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if props != nil {
+		data, err := json.Marshal(props)
+		if err != nil {
+			return nil, fmt.Errorf("unable to encode props: %v", err)
+		}
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, fmt.Errorf("unable to encode props as a json object: %v", err)
+		}
+	}
+	if fields == nil {
+		fields = map[string]json.RawMessage{}
+	}
+	if _, ok := fields["ServiceToken"]; !ok {
+		fields["ServiceToken"] = json.RawMessage(fmt.Sprintf("%q", ServiceToken))
+	}
+	return json.Marshal(fields)
+}
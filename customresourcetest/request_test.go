@@ -0,0 +1,151 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresourcetest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/savaki/customresource"
+)
+
+type transportFunc func(req *http.Request) (*http.Response, error)
+
+func (fn transportFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+func TestNewRequest(t *testing.T) {
+	type Props struct {
+		Name string
+	}
+
+	req := NewRequest(customresource.RequestTypeCreate, Props{Name: "blah"})
+	if req.RequestId == "" {
+		t.Fatalf("got empty; want RequestId")
+	}
+	if got, want := req.StackId, StackId; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := req.PhysicalResourceId, ""; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	var props Props
+	if err := json.Unmarshal(req.ResourceProperties, &props); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := props.Name, "blah"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := customresource.ServiceToken(req), ServiceToken; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	if got := NewRequest(customresource.RequestTypeCreate, nil).RequestId; got == req.RequestId {
+		t.Fatalf("got %v; want unique RequestId", got)
+	}
+	if got, want := NewRequest(customresource.RequestTypeDelete, nil).PhysicalResourceId, PhysicalResourceId; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+func TestNewRequestValid(t *testing.T) {
+	testCases := map[string]struct {
+		Option customresource.Option
+	}{
+		"require tls": {
+			Option: customresource.WithRequireTLS(),
+		},
+		"service token": {
+			Option: customresource.WithValidateServiceToken(),
+		},
+		"resource type format": {
+			Option: customresource.WithValidateResourceTypeFormat(),
+		},
+		"request id": {
+			Option: customresource.WithValidateRequestId(),
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx = lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{
+					InvokedFunctionArn: ServiceToken,
+				})
+				input customresource.ReplyInput
+				rt    = func(req *http.Request) (*http.Response, error) {
+					json.NewDecoder(req.Body).Decode(&input)
+					w := httptest.NewRecorder()
+					w.WriteHeader(http.StatusOK)
+					return w.Result(), nil
+				}
+				fn = func(ctx context.Context, req *customresource.Request) (*customresource.Response, error) {
+					return &customresource.Response{PhysicalResourceId: "abc"}, nil
+				}
+			)
+
+			handler := customresource.New(fn, customresource.WithTransport(transportFunc(rt)), tc.Option)
+			for _, requestType := range []string{customresource.RequestTypeCreate, customresource.RequestTypeUpdate, customresource.RequestTypeDelete} {
+				input = customresource.ReplyInput{}
+				data, err := json.Marshal(NewRequest(requestType, nil))
+				if err != nil {
+					t.Fatalf("got %v; want nil", err)
+				}
+				if _, err := handler.Invoke(ctx, data); err != nil {
+					t.Fatalf("got %v; want nil", err)
+				}
+				if got, want := input.Status, customresource.StatusSuccess; got != want {
+					t.Fatalf("got %v; want %v: %v", got, want, input.Reason)
+				}
+			}
+		})
+	}
+
+	t.Run("service token checked", func(t *testing.T) {
+		var (
+			ctx = lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{
+				InvokedFunctionArn: "arn:aws:lambda:us-east-1:123456789012:function:other",
+			})
+			input customresource.ReplyInput
+			rt    = func(req *http.Request) (*http.Response, error) {
+				json.NewDecoder(req.Body).Decode(&input)
+				w := httptest.NewRecorder()
+				w.WriteHeader(http.StatusOK)
+				return w.Result(), nil
+			}
+			fn = func(ctx context.Context, req *customresource.Request) (*customresource.Response, error) {
+				return &customresource.Response{PhysicalResourceId: "abc"}, nil
+			}
+		)
+
+		handler := customresource.New(fn, customresource.WithTransport(transportFunc(rt)), customresource.WithValidateServiceToken())
+		data, err := json.Marshal(NewRequest(customresource.RequestTypeCreate, nil))
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if _, err := handler.Invoke(ctx, data); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := input.Status, customresource.StatusFailed; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresourcetest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// S3Request records a request received by an S3Stub
+type S3Request struct {
+	Method      string
+	Path        string
+	ContentType string
+	Body        []byte
+	// StatusCode is the status returned by the stub
+	StatusCode int
+}
+
+// S3Stub mimics the S3 presigned PUT url CloudFormation provides as the
+// ResponseURL.  The presigned url is signed without a Content-Type, so, like
+// S3, the stub rejects any request carrying one with 403 SignatureDoesNotMatch.
+type S3Stub struct {
+	// URL is a presigned-like url suitable for use as the ResponseURL
+	URL string
+
+	server   *httptest.Server
+	mutex    sync.Mutex
+	requests []S3Request
+}
+
+// NewS3Stub starts and returns a new S3Stub.  Callers should Close the stub
+// when done.
+func NewS3Stub() *S3Stub {
+	s := &S3Stub{}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.server.URL + "/test-bucket/response?X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Signature=stub"
+	return s
+}
+
+func (s *S3Stub) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+
+	status := http.StatusOK
+	switch {
+	case req.Method != http.MethodPut:
+		status = http.StatusMethodNotAllowed
+	case req.Header.Get("Content-Type") != "":
+		status = http.StatusForbidden
+	}
+
+	s.mutex.Lock()
+	s.requests = append(s.requests, S3Request{
+		Method:      req.Method,
+		Path:        req.URL.Path,
+		ContentType: req.Header.Get("Content-Type"),
+		Body:        body,
+		StatusCode:  status,
+	})
+	s.mutex.Unlock()
+
+	if status == http.StatusForbidden {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(status)
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><Error><Code>SignatureDoesNotMatch</Code><Message>The request signature we calculated does not match the signature you provided.</Message></Error>`))
+		return
+	}
+	w.WriteHeader(status)
+}
+
+// Requests returns the requests received by the stub
+func (s *S3Stub) Requests() []S3Request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]S3Request(nil), s.requests...)
+}
+
+// Close shuts down the stub
+func (s *S3Stub) Close() {
+	s.server.Close()
+}
@@ -0,0 +1,76 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresourcetest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/savaki/customresource"
+)
+
+func TestS3Stub(t *testing.T) {
+	testCases := map[string]struct {
+		Options    []customresource.Option
+		StatusCode int
+	}{
+		"no content type": {
+			StatusCode: http.StatusOK,
+		},
+		"content type": {
+			Options:    []customresource.Option{customresource.WithReplyContentType("application/json")},
+			StatusCode: http.StatusForbidden,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			stub := NewS3Stub()
+			defer stub.Close()
+
+			var (
+				ctx = context.Background()
+				fn  = func(ctx context.Context, req *customresource.Request) (*customresource.Response, error) {
+					return &customresource.Response{PhysicalResourceId: "abc"}, nil
+				}
+				req = NewRequest(customresource.RequestTypeCreate, nil)
+			)
+			req.ResponseURL = stub.URL
+
+			opts := append([]customresource.Option{customresource.WithTransport(http.DefaultTransport)}, tc.Options...)
+			handler := customresource.New(fn, opts...)
+			data, _ := json.Marshal(req)
+			handler.Invoke(ctx, data)
+
+			requests := stub.Requests()
+			if got, want := len(requests), 1; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := requests[0].StatusCode, tc.StatusCode; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+
+			var reply customresource.ReplyInput
+			if err := json.Unmarshal(requests[0].Body, &reply); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := reply.Status, customresource.StatusSuccess; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
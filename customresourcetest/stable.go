@@ -0,0 +1,104 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresourcetest
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"github.com/savaki/customresource"
+)
+
+// AssertDataStable fails the test if the Data of the Update reply differs
+// from the Data of the Create reply, other than for allowedChangedKeys.
+// Attributes that churn on Update ripple to every resource referencing them
+// via !GetAtt.  Typically used with the replies from Lifecycle, e.g.
+//
+//	result, err := customresourcetest.Lifecycle(ctx, fn, createProps, updateProps)
+//	customresourcetest.AssertDataStable(t, result.Create, result.Update, "LastModified")
+func AssertDataStable(tt TestingT, createReply, updateReply *customresource.ReplyInput, allowedChangedKeys ...string) {
+	tt.Helper()
+
+	if createReply == nil || updateReply == nil {
+		tt.Errorf("missing reply; want both Create and Update replies")
+		return
+	}
+
+	before, err := dataMap(createReply.Data)
+	if err != nil {
+		tt.Errorf("unable to read Create Data: %v", err)
+		return
+	}
+	after, err := dataMap(updateReply.Data)
+	if err != nil {
+		tt.Errorf("unable to read Update Data: %v", err)
+		return
+	}
+
+	allowed := map[string]struct{}{}
+	for _, key := range allowedChangedKeys {
+		allowed[key] = struct{}{}
+	}
+
+	keys := make([]string, 0, len(before)+len(after))
+	for k := range before {
+		keys = append(keys, k)
+	}
+	for k := range after {
+		if _, ok := before[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if _, ok := allowed[key]; ok {
+			continue
+		}
+		was, hadBefore := before[key]
+		now, hasAfter := after[key]
+		switch {
+		case !hasAfter:
+			tt.Errorf("Data %v removed on Update; was %v", key, was)
+		case !hadBefore:
+			tt.Errorf("Data %v added on Update; now %v", key, now)
+		case !reflect.DeepEqual(was, now):
+			tt.Errorf("Data %v changed on Update; got %v; want %v", key, now, was)
+		}
+	}
+}
+
+// dataMap normalizes the Data of a reply, which may be of any type, to the
+// json object CloudFormation receives
+func dataMap(data interface{}) (map[string]interface{}, error) {
+	if data == nil {
+		return map[string]interface{}{}, nil
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(encoded, &m); err != nil {
+		return nil, err
+	}
+	if m == nil {
+		m = map[string]interface{}{}
+	}
+	return m, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresourcetest
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/savaki/customresource"
+)
+
+func TestAssertDataStable(t *testing.T) {
+	// widget returns its props as Data along with a Version that changes on
+	// every Update
+	widget := func(ctx context.Context, req *customresource.Request) (*customresource.Response, error) {
+		var data map[string]interface{}
+		if err := json.Unmarshal(req.ResourceProperties, &data); err != nil {
+			return nil, err
+		}
+		data["Version"] = req.RequestType
+		return &customresource.Response{PhysicalResourceId: "widget", Data: data}, nil
+	}
+
+	testCases := map[string]struct {
+		UpdateProps interface{}
+		Allowed     []string
+		Errors      []string
+	}{
+		"stable": {
+			UpdateProps: map[string]interface{}{"Name": "a", "Size": 1},
+			Allowed:     []string{"Version"},
+		},
+		"churn": {
+			UpdateProps: map[string]interface{}{"Name": "b", "Size": 1},
+			Allowed:     []string{"Version"},
+			Errors:      []string{"Data Name changed on Update; got b; want a"},
+		},
+		"not allowed": {
+			UpdateProps: map[string]interface{}{"Name": "a", "Size": 1},
+			Errors:      []string{"Data Version changed on Update; got Update; want Create"},
+		},
+		"added and removed": {
+			UpdateProps: map[string]interface{}{"Name": "a", "Color": "red"},
+			Allowed:     []string{"Version"},
+			Errors: []string{
+				"Data Color added on Update; now red",
+				"Data Size removed on Update; was 1",
+			},
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			createProps := map[string]interface{}{"Name": "a", "Size": 1}
+			result, err := Lifecycle(context.Background(), widget, createProps, tc.UpdateProps)
+			if err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+
+			r := &recorder{}
+			AssertDataStable(r, result.Create, result.Update, tc.Allowed...)
+			if got, want := r.errors, tc.Errors; !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresourcetest
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/savaki/customresource"
+)
+
+// Transport captures the reply sent by a Handler and records any other
+// request made through it.  Sharing the Transport with the dependencies of a
+// Func, e.g. &http.Client{Transport: transport}, detects calls that were not
+// mocked out.
+type Transport struct {
+	// ResponseURL identifies the reply; defaults to ResponseURL
+	ResponseURL string
+
+	mutex    sync.Mutex
+	replies  []customresource.ReplyInput
+	unmocked []*http.Request
+}
+
+// NewTransport returns a Transport expecting replies to ResponseURL
+func NewTransport() *Transport {
+	return &Transport{
+		ResponseURL: ResponseURL,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if req.Method != http.MethodPut || req.URL.String() != t.ResponseURL {
+		t.unmocked = append(t.unmocked, req)
+		return nil, fmt.Errorf("customresourcetest: unmocked request, %v %v", req.Method, req.URL)
+	}
+
+	body := io.Reader(req.Body)
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		r, err := gzip.NewReader(req.Body)
+		if err != nil {
+			return nil, fmt.Errorf("customresourcetest: unable to decompress reply: %v", err)
+		}
+		body = r
+	}
+
+	var reply customresource.ReplyInput
+	if err := json.NewDecoder(body).Decode(&reply); err != nil {
+		return nil, fmt.Errorf("customresourcetest: unable to decode reply: %v", err)
+	}
+	t.replies = append(t.replies, reply)
+
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
+
+// Reply returns the most recent reply or nil if no reply has been sent
+func (t *Transport) Reply() *customresource.ReplyInput {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if len(t.replies) == 0 {
+		return nil
+	}
+	reply := t.replies[len(t.replies)-1]
+	return &reply
+}
+
+// Unmocked returns the requests, other than replies, made via the Transport
+func (t *Transport) Unmocked() []*http.Request {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return append([]*http.Request(nil), t.unmocked...)
+}
+
+// TestingT is the subset of testing.T used by the assertion helpers
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// AssertPure fails the test if any request other than a reply was made
+func (t *Transport) AssertPure(tt TestingT) {
+	tt.Helper()
+	for _, req := range t.Unmocked() {
+		tt.Errorf("unexpected request, %v %v", req.Method, req.URL)
+	}
+}
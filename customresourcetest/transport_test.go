@@ -0,0 +1,92 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresourcetest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/savaki/customresource"
+)
+
+type recorder struct {
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestTransport(t *testing.T) {
+	t.Run("pure", func(t *testing.T) {
+		var (
+			ctx       = context.Background()
+			transport = NewTransport()
+			fn        = func(ctx context.Context, req *customresource.Request) (*customresource.Response, error) {
+				return &customresource.Response{PhysicalResourceId: "abc"}, nil
+			}
+		)
+
+		handler := customresource.New(fn, customresource.WithTransport(transport))
+		data, _ := json.Marshal(NewRequest(customresource.RequestTypeCreate, nil))
+		if _, err := handler.Invoke(ctx, data); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := transport.Reply().Status, customresource.StatusSuccess; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+
+		r := &recorder{}
+		transport.AssertPure(r)
+		if got, want := len(r.errors), 0; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("unmocked", func(t *testing.T) {
+		var (
+			ctx       = context.Background()
+			transport = NewTransport()
+			client    = &http.Client{Transport: transport}
+			fn        = func(ctx context.Context, req *customresource.Request) (*customresource.Response, error) {
+				// an accidental, un-mocked, call to an external service
+				if resp, err := client.Get("https://example.com/api"); err == nil {
+					resp.Body.Close()
+				}
+				return &customresource.Response{PhysicalResourceId: "abc"}, nil
+			}
+		)
+
+		handler := customresource.New(fn, customresource.WithTransport(transport))
+		data, _ := json.Marshal(NewRequest(customresource.RequestTypeCreate, nil))
+		if _, err := handler.Invoke(ctx, data); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := len(transport.Unmocked()), 1; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+
+		r := &recorder{}
+		transport.AssertPure(r)
+		if got, want := len(r.errors), 1; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+}
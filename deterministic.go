@@ -0,0 +1,29 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import "math/rand"
+
+// deterministicSeed seeds the random source used by WithDeterministic
+const deterministicSeed = 1
+
+// WithDeterministic routes all randomness, e.g. the rolls made by WithChaos,
+// through a source with a fixed seed so repeated runs produce identical
+// replies.  Intended for snapshot and golden tests.
+func WithDeterministic() Option {
+	return func(o *options) {
+		o.random = rand.New(rand.NewSource(deterministicSeed))
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestWithDeterministic(t *testing.T) {
+	var (
+		ctx = context.Background()
+		fn  = func(ctx context.Context, req *Request) (*Response, error) {
+			return &Response{PhysicalResourceId: "abc", Data: map[string]interface{}{"Arn": "arn:test"}}, nil
+		}
+		data = marshalRequest(t, Request{RequestType: RequestTypeCreate, LogicalResourceId: "Resource"})
+	)
+
+	run := func() []byte {
+		buf := bytes.NewBuffer(nil)
+		rt := func(req *http.Request) (*http.Response, error) {
+			body, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(body)
+			buf.WriteString("\n")
+			return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewReader(nil))}, nil
+		}
+
+		handler := New(fn,
+			WithTransport(transportFunc(rt)),
+			WithChaos(ChaosConfig{FailureProbability: 0.5, Handler: true}),
+			WithDeterministic(),
+		)
+		for i := 0; i < 20; i++ {
+			handler.Invoke(ctx, data)
+		}
+		return buf.Bytes()
+	}
+
+	first, second := run(), run()
+	if !bytes.Equal(first, second) {
+		t.Fatalf("got %s; want %s", second, first)
+	}
+	if !bytes.Contains(first, []byte(StatusFailed)) || !bytes.Contains(first, []byte(StatusSuccess)) {
+		t.Fatalf("got %s; want both SUCCESS and FAILED replies", first)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ReplyEncoder serializes the reply sent to the ResponseURL
+type ReplyEncoder interface {
+	// Encode returns the encoded reply along with its content type.  An empty
+	// content type means no Content-Type header will be sent.
+	Encode(input *ReplyInput) (data []byte, contentType string, err error)
+}
+
+// jsonEncoder encodes replies as json.  No content type is returned as the
+// presigned S3 url provided by CloudFormation is signed without one.
+type jsonEncoder struct{}
+
+func (jsonEncoder) Encode(input *ReplyInput) ([]byte, string, error) {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, "", nil
+}
+
+// defaultPhysicalIDKey is the key CloudFormation expects the physical id under
+const defaultPhysicalIDKey = "PhysicalResourceId"
+
+// physicalIDKeyEncoder renames the physical id in the json encoded by
+// ReplyEncoder
+type physicalIDKeyEncoder struct {
+	ReplyEncoder
+	key string
+}
+
+func (p physicalIDKeyEncoder) Encode(input *ReplyInput) ([]byte, string, error) {
+	data, contentType, err := p.ReplyEncoder.Encode(input)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, "", fmt.Errorf("unable to rename %v; reply is not a json object: %v", defaultPhysicalIDKey, err)
+	}
+	if v, ok := fields[defaultPhysicalIDKey]; ok {
+		delete(fields, defaultPhysicalIDKey)
+		fields[p.key] = v
+	}
+
+	data, err = json.Marshal(fields)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, contentType, nil
+}
+
+// WithPhysicalIDKey sends the physical id under key, rather than
+// PhysicalResourceId, for orchestrators that expect a different reply
+// envelope.  Applies to the json produced by any ReplyEncoder.
+func WithPhysicalIDKey(key string) Option {
+	return func(o *options) {
+		o.physicalIDKey = key
+	}
+}
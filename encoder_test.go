@@ -0,0 +1,217 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+type encoderFunc func(input *ReplyInput) ([]byte, string, error)
+
+func (fn encoderFunc) Encode(input *ReplyInput) ([]byte, string, error) {
+	return fn(input)
+}
+
+func TestWithReplyEncoder(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		var (
+			ctx         = context.Background()
+			contentType []string
+			rt          = func(req *http.Request) (*http.Response, error) {
+				contentType = req.Header["Content-Type"]
+				w := httptest.NewRecorder()
+				w.WriteHeader(http.StatusOK)
+				return w.Result(), nil
+			}
+			fn = func(ctx context.Context, req *Request) (*Response, error) {
+				return &Response{PhysicalResourceId: "blah"}, nil
+			}
+		)
+
+		data, _ := json.Marshal(Request{RequestType: RequestTypeCreate, ResponseURL: "http://localhost"})
+		handler := New(fn, WithTransport(transportFunc(rt)))
+		if _, err := handler.Invoke(ctx, data); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got := contentType; got != nil {
+			t.Fatalf("got %v; want nil", got)
+		}
+	})
+
+	t.Run("headers", func(t *testing.T) {
+		var (
+			ctx    = context.Background()
+			header http.Header
+			length int64
+			body   []byte
+			rt     = func(req *http.Request) (*http.Response, error) {
+				header, length = req.Header, req.ContentLength
+				body, _ = ioutil.ReadAll(req.Body)
+				w := httptest.NewRecorder()
+				w.WriteHeader(http.StatusOK)
+				return w.Result(), nil
+			}
+			fn = func(ctx context.Context, req *Request) (*Response, error) {
+				return &Response{PhysicalResourceId: "blah"}, nil
+			}
+		)
+
+		data, _ := json.Marshal(Request{RequestType: RequestTypeCreate, ResponseURL: "http://localhost"})
+		handler := New(fn, WithTransport(transportFunc(rt)))
+		if _, err := handler.Invoke(ctx, data); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if _, ok := header["Content-Type"]; ok {
+			t.Fatalf("got Content-Type %v; want none", header.Get("Content-Type"))
+		}
+		if got, want := length, int64(len(body)); got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := header.Get("Content-Length"), strconv.Itoa(len(body)); got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		var (
+			ctx         = context.Background()
+			contentType string
+			body        []byte
+			rt          = func(req *http.Request) (*http.Response, error) {
+				contentType = req.Header.Get("Content-Type")
+				body, _ = ioutil.ReadAll(req.Body)
+				w := httptest.NewRecorder()
+				w.WriteHeader(http.StatusOK)
+				return w.Result(), nil
+			}
+			fn = func(ctx context.Context, req *Request) (*Response, error) {
+				return &Response{PhysicalResourceId: "blah"}, nil
+			}
+			encoder = func(input *ReplyInput) ([]byte, string, error) {
+				return []byte(input.Status + ":" + input.PhysicalResourceId), "application/x-msgpack", nil
+			}
+		)
+
+		data, _ := json.Marshal(Request{RequestType: RequestTypeCreate, ResponseURL: "http://localhost"})
+		handler := New(fn, WithTransport(transportFunc(rt)), WithReplyEncoder(encoderFunc(encoder)))
+		if _, err := handler.Invoke(ctx, data); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := contentType, "application/x-msgpack"; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := string(body), "SUCCESS:blah"; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+}
+
+func TestWithReplyContentType(t *testing.T) {
+	testCases := map[string]struct {
+		Options     []Option
+		ContentType []string
+	}{
+		"default": {},
+		"configured": {
+			Options:     []Option{WithReplyContentType("application/json")},
+			ContentType: []string{"application/json"},
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx         = context.Background()
+				contentType []string
+				rt          = func(req *http.Request) (*http.Response, error) {
+					contentType = req.Header["Content-Type"]
+					w := httptest.NewRecorder()
+					w.WriteHeader(http.StatusOK)
+					return w.Result(), nil
+				}
+				fn = func(ctx context.Context, req *Request) (*Response, error) {
+					return &Response{PhysicalResourceId: "blah"}, nil
+				}
+			)
+
+			handler := New(fn, append([]Option{WithTransport(transportFunc(rt))}, tc.Options...)...)
+			if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := contentType, tc.ContentType; !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestWithPhysicalIDKey(t *testing.T) {
+	testCases := map[string]struct {
+		Options []Option
+		Key     string
+	}{
+		"default": {
+			Key: "PhysicalResourceId",
+		},
+		"configured": {
+			Options: []Option{WithPhysicalIDKey("resourceId")},
+			Key:     "resourceId",
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx  = context.Background()
+				body map[string]interface{}
+				rt   = func(req *http.Request) (*http.Response, error) {
+					if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+						t.Fatalf("got %v; want nil", err)
+					}
+					w := httptest.NewRecorder()
+					w.WriteHeader(http.StatusOK)
+					return w.Result(), nil
+				}
+				fn = func(ctx context.Context, req *Request) (*Response, error) {
+					return &Response{PhysicalResourceId: "abc"}, nil
+				}
+			)
+
+			opts := append([]Option{WithTransport(transportFunc(rt))}, tc.Options...)
+			handler := New(fn, opts...)
+			if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := body[tc.Key], "abc"; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if tc.Key != "PhysicalResourceId" {
+				if _, ok := body["PhysicalResourceId"]; ok {
+					t.Fatalf("got PhysicalResourceId; want renamed")
+				}
+			}
+			if got, want := body["Status"], StatusSuccess; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
@@ -1,3 +1,5 @@
 module github.com/savaki/customresource
 
+go 1.18
+
 require github.com/aws/aws-lambda-go v1.10.0
@@ -0,0 +1,45 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"bytes"
+	"compress/gzip"
+)
+
+// contentEncodingGzip is sent as the Content-Encoding of compressed replies
+const contentEncodingGzip = "gzip"
+
+// gzipReply compresses the encoded reply
+func gzipReply(data []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	w := gzip.NewWriter(buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WithGzip compresses the reply and sends it with Content-Encoding: gzip.
+// Off by default; the presigned url must permit the header or the reply is
+// rejected, so verify it against a real stack before enabling.
+func WithGzip(enabled bool) Option {
+	return func(o *options) {
+		o.gzip = enabled
+	}
+}
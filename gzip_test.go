@@ -0,0 +1,87 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestWithGzip(t *testing.T) {
+	testCases := map[string]struct {
+		Enabled  bool
+		Encoding string
+	}{
+		"enabled": {
+			Enabled:  true,
+			Encoding: "gzip",
+		},
+		"disabled": {
+			Enabled:  false,
+			Encoding: "",
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx      = context.Background()
+				input    ReplyInput
+				encoding string
+				fn       = func(ctx context.Context, req *Request) (*Response, error) {
+					return &Response{PhysicalResourceId: "abc", Data: map[string]interface{}{"Arn": "arn:aws:s3:::blue"}}, nil
+				}
+				transport = transportFunc(func(req *http.Request) (*http.Response, error) {
+					encoding = req.Header.Get("Content-Encoding")
+
+					body := req.Body
+					if encoding == "gzip" {
+						r, err := gzip.NewReader(req.Body)
+						if err != nil {
+							t.Fatalf("got %v; want nil", err)
+						}
+						body = r
+					}
+					if err := json.NewDecoder(body).Decode(&input); err != nil {
+						t.Fatalf("got %v; want nil", err)
+					}
+
+					w := httptest.NewRecorder()
+					w.WriteHeader(http.StatusOK)
+					return w.Result(), nil
+				})
+				handler = New(fn, WithTransport(transport), WithGzip(tc.Enabled))
+			)
+
+			if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := encoding, tc.Encoding; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := input.Status, StatusSuccess; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := input.Data, map[string]interface{}{"Arn": "arn:aws:s3:::blue"}; !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
@@ -18,10 +18,21 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
@@ -30,11 +41,39 @@ const (
 	RequestTypeDelete = "Delete"
 )
 
+// RequestTypes lists the request types sent by CloudFormation
+var RequestTypes = []string{RequestTypeCreate, RequestTypeUpdate, RequestTypeDelete}
+
+// IsValidRequestType returns true if requestType is one of RequestTypes
+func IsValidRequestType(requestType string) bool {
+	for _, rt := range RequestTypes {
+		if requestType == rt {
+			return true
+		}
+	}
+	return false
+}
+
 const (
 	StatusSuccess = "SUCCESS"
 	StatusFailed  = "FAILED"
 )
 
+// outcomePanic is reported by the summary line when the Func panicked
+const outcomePanic = "PANIC"
+
+// summary is the json object written by WithSummaryLine
+type summary struct {
+	Event              string `json:"event"`
+	LogicalResourceId  string `json:"logicalResourceId"`
+	RequestType        string `json:"requestType"`
+	RequestId          string `json:"requestId"`
+	Outcome            string `json:"outcome"`
+	DurationMs         int64  `json:"durationMs"`
+	PhysicalResourceId string `json:"physicalResourceId"`
+	ReplyStatus        string `json:"replyStatus"`
+}
+
 // Request that arrives from AWS
 type Request struct {
 	RequestType           string
@@ -46,6 +85,9 @@ type Request struct {
 	PhysicalResourceId    string
 	ResourceProperties    json.RawMessage `json:",omitempty"`
 	OldResourceProperties json.RawMessage `json:",omitempty"`
+	// ClientRequestToken identifies the stack operation, when provided.
+	// Standard CloudFormation events omit it; see OperationID.
+	ClientRequestToken string `json:",omitempty"`
 }
 
 // Response contains the successful response to our request
@@ -56,6 +98,16 @@ type Response struct {
 	PhysicalResourceId string
 	// NoEcho prevents Data from being returned by !GetAtt
 	NoEcho bool
+	// Reason optionally provides an informational message with a successful
+	// reply.  CloudFormation ignores it, but compatible orchestrators may not.
+	Reason string
+	// RawData, when set, is sent verbatim as the Data in place of Data, e.g.
+	// for nested outputs whose shape or field order matters.  RawData must be
+	// a json object.  WithOutputSchema validates RawData in place of Data;
+	// other checks of the Data do not apply to RawData.
+	RawData json.RawMessage
+
+	responder Responder
 }
 
 // Func to encapsulate custom resource logic
@@ -63,102 +115,1013 @@ type Func func(ctx context.Context, req *Request) (*Response, error)
 
 // Handler provides a lambda wrapper to manage the lifecycle of a custom resource
 type Handler struct {
-	fn        Func
-	output    io.Writer
-	transport http.RoundTripper
+	fn                   Func
+	logger               Logger
+	logging              bool
+	transport            http.RoundTripper
+	encoder              ReplyEncoder
+	deleteRetry          deleteRetry
+	summaryLine          bool
+	strictPhysicalID     bool
+	chaos                *chaos
+	validateServiceToken bool
+	successOnError       func(error) bool
+	errorReasons         []errorReason
+	canceledReplyTimeout time.Duration
+	sensitiveKeys        map[string]struct{}
+	requireTLS           bool
+	timeoutRetries       int
+	requireNonEmptyData  bool
+	idempotencyTokenKey  string
+	archive              *archive
+	replyContext         func(context.Context) (context.Context, context.CancelFunc)
+	validateResourceType bool
+	physicalIDEqual      func(old, new string) bool
+	replyRetry           replyRetry
+	metrics              MetricsCollector
+	replyContentType     string
+	awsErrorReasons      bool
+	maxDataAttributes    int
+	recoverRetry         []func()
+	clock                clock
+	postReplyGrace       time.Duration
+	reasonNewline        string
+	outputSchema         *outputSchema
+	recursionGuard       *recursionGuard
+	logLevel             LogLevel
+	partialDataOnPanic   bool
+	physicalIDValidator  func(string) error
+	routeTracing         bool
+	memoryWatchdog       *memoryWatchdog
+	localStats           *localStats
+	minRemainingTime     time.Duration
+	distributedLock      *distributedLock
+	timeoutBuffer        time.Duration
+	validateRequestId    bool
+	coalescers           []*coalescer
+	createVerify         func(context.Context, *Request, *Response) error
+	maxDataSize          int
+	maxReasonLength      int
+	coldStart            bool
+	physicalResourceID   func(*Request) string
+	logLink              bool
+	idempotency          IdempotencyStore
+	noOpUpdateReplay     ReplayStore
+	propertySchema       *propertySchema
+	replyTimeout         time.Duration
+	dryRun               bool
+	reasonFormatter      func(*Request, error) string
+	snsEnvelope          bool
+	reinvoker            Reinvoker
+	gzip                 bool
+	lastReply            *lastReply
+	httpClient           *http.Client
+}
+
+type replyRetry struct {
+	attempts int
+	backoff  time.Duration
+}
+
+type deleteRetry struct {
+	isBusy   func(error) bool
+	attempts int
+	backoff  time.Duration
 }
 
-type replyInput struct {
+// ReplyInput contains the reply sent to the ResponseURL
+type ReplyInput struct {
 	Status             string
 	Reason             string
 	PhysicalResourceId string
 	StackId            string
 	RequestId          string
 	LogicalResourceId  string
+	NoEcho             bool
 	Data               interface{}
 }
 
-func (h *Handler) reply(ctx context.Context, req *Request, input *replyInput) error {
-	data, err := json.Marshal(input)
+// localReplyStatus is the reply status when the reply is not sent, either
+// because the request has no ResponseURL or WithDryRun is set
+const localReplyStatus = "not sent"
+
+// describeReply summarizes input for logging.  Data is omitted as it may hold
+// secrets; see WithLogHashSensitive to log it redacted.
+func describeReply(input *ReplyInput) string {
+	return fmt.Sprintf("status=%v physicalResourceId=%v reason=%q", input.Status, input.PhysicalResourceId, input.Reason)
+}
+
+// reply sends the input to the ResponseURL and returns the http status received
+func (h *Handler) reply(ctx context.Context, req *Request, input *ReplyInput) (string, int, error) {
+	data, contentType, err := h.encoder.Encode(input)
 	if err != nil {
-		return fmt.Errorf("unable to marshal reply")
+		return "", 0, fmt.Errorf("unable to encode reply: %v", err)
+	}
+	if h.replyContentType != "" {
+		contentType = h.replyContentType
+	}
+	if h.dryRun {
+		h.logf(LogInfo, req, "%v: dry run, reply not sent - %v\n", req.LogicalResourceId, describeReply(input))
+		return localReplyStatus, 0, nil
+	}
+	if req.ResponseURL == "" {
+		// invoked locally e.g. with a dummy event; there is no one to reply to
+		h.logf(LogInfo, req, "%v: no ResponseURL, reply not sent - %v\n", req.LogicalResourceId, describeReply(input))
+		return localReplyStatus, 0, nil
+	}
+	if h.gzip {
+		if data, err = gzipReply(data); err != nil {
+			return "", 0, fmt.Errorf("unable to compress reply: %v", err)
+		}
+	}
+
+	var retries int
+	status, code, err := h.putWithTimeout(ctx, req, data, contentType)
+	for ; err != nil && retries+1 < h.replyRetry.attempts; retries++ {
+		h.logf(LogWarn, req, "%v: reply failed, retrying in %v - %v\n", req.LogicalResourceId, h.replyRetry.backoff, err)
+		if h.clock.Sleep(ctx, h.replyRetry.backoff) != nil {
+			break
+		}
+		status, code, err = h.putWithTimeout(ctx, req, data, contentType)
+	}
+
+	if h.metrics != nil && retries > 0 {
+		outcome := replyRetrySucceeded
+		if err != nil {
+			outcome = replyRetryExhausted
+		}
+		for i := 0; i < retries; i++ {
+			h.metrics.Add(metricReplyRetry, 1, map[string]string{"outcome": outcome})
+		}
+	}
+
+	return status, code, err
+}
+
+// putWithTimeout performs a single PUT of the reply bounded by the timeout
+// set via WithReplyTimeout, if any
+func (h *Handler) putWithTimeout(ctx context.Context, req *Request, data []byte, contentType string) (string, int, error) {
+	if h.replyTimeout <= 0 {
+		return h.put(ctx, req.ResponseURL, data, contentType)
 	}
 
-	httpReq, err := http.NewRequest(http.MethodPut, req.ResponseURL, bytes.NewReader(data))
+	c, cancel := context.WithTimeout(ctx, h.replyTimeout)
+	defer cancel()
+
+	status, code, err := h.put(c, req.ResponseURL, data, contentType)
+	if err != nil && c.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		err = fmt.Errorf("reply timed out after %v: %v", h.replyTimeout, err)
+		h.logf(LogError, req, "%v: %v\n", req.LogicalResourceId, err)
+	}
+	return status, code, err
+}
+
+// put performs a single PUT of the reply to the ResponseURL
+func (h *Handler) put(ctx context.Context, responseURL string, data []byte, contentType string) (string, int, error) {
+	httpReq, err := http.NewRequest(http.MethodPut, responseURL, bytes.NewReader(data))
 	if err != nil {
-		return err
+		return "", 0, err
 	}
+	// the presigned url is signed without a Content-Type so, unless the
+	// encoder asks for one, none may be sent
 	httpReq.Header.Del("Content-Type")
+	if contentType != "" {
+		httpReq.Header.Set("Content-Type", contentType)
+	}
+	if h.gzip {
+		httpReq.Header.Set("Content-Encoding", contentEncodingGzip)
+	}
+	httpReq.ContentLength = int64(len(data))
+	httpReq.Header.Set("Content-Length", strconv.Itoa(len(data)))
 	httpReq = httpReq.WithContext(ctx)
 
-	httpResp, err := h.transport.RoundTrip(httpReq)
+	var httpResp *http.Response
+	if h.httpClient != nil {
+		httpResp, err = h.httpClient.Do(httpReq)
+	} else {
+		httpResp, err = h.transport.RoundTrip(httpReq)
+	}
 	if err != nil {
-		return err
+		return "", 0, err
 	}
 	defer httpResp.Body.Close()
 
-	fmt.Fprintln(h.output, httpResp.Status)
-	io.Copy(h.output, httpResp.Body)
+	ok := httpResp.StatusCode/100 == 2
+	var body []byte
+	if !ok || h.logEnabled(LogInfo) {
+		body, _ = ioutil.ReadAll(io.LimitReader(httpResp.Body, maxLoggedBody))
+		body = bytes.TrimSpace(body)
+	}
+	if h.logEnabled(LogInfo) {
+		h.logf(LogInfo, nil, "%v\n", httpResp.Status)
+		if len(body) > 0 {
+			h.logf(LogInfo, nil, "%s\n", body)
+		}
+	}
 
-	return nil
+	if !ok {
+		if len(body) > maxErrorBody {
+			body = append(body[:maxErrorBody:maxErrorBody], reasonEllipsis...)
+		}
+		return httpResp.Status, httpResp.StatusCode, fmt.Errorf("reply rejected with %v: %s", httpResp.Status, body)
+	}
+	return httpResp.Status, httpResp.StatusCode, nil
 }
 
-func (h *Handler) replySuccess(ctx context.Context, req *Request, resp *Response) error {
-	fmt.Fprintf(h.output, "%v: %v succeeded. PhysicalResourceId=%v\n", req.LogicalResourceId, req.RequestType, resp.PhysicalResourceId)
-	input := replyInput{
+// newSuccessReply returns the reply for a successful Func
+func (h *Handler) newSuccessReply(req *Request, resp *Response) *ReplyInput {
+	h.logf(LogInfo, req, "%v: %v succeeded. PhysicalResourceId=%v\n", req.LogicalResourceId, req.RequestType, resp.PhysicalResourceId)
+	if h.isReplacement(req, resp) {
+		h.logf(LogInfo, req, "%v: %v replaces PhysicalResourceId %v with %v\n", req.LogicalResourceId, req.RequestType, req.PhysicalResourceId, resp.PhysicalResourceId)
+	}
+	if h.sensitiveKeys != nil {
+		h.logf(LogInfo, req, "%v: Data=%v\n", req.LogicalResourceId, redactData(resp.Data, h.sensitiveKeys))
+	}
+	var data interface{} = resp.Data
+	if resp.RawData != nil {
+		if resp.Data != nil {
+			h.logf(LogWarn, req, "%v: %v returned both Data and RawData; using RawData\n", req.LogicalResourceId, req.RequestType)
+		}
+		data = resp.RawData
+	} else if h.outputSchema != nil {
+		data = h.outputSchema.inject(resp.Data)
+	}
+	input := ReplyInput{
 		Status:             StatusSuccess,
+		Reason:             truncateReason(normalizeReason(resp.Reason, h.reasonNewline), h.maxReasonLength),
 		PhysicalResourceId: resp.PhysicalResourceId,
 		StackId:            req.StackId,
 		RequestId:          req.RequestId,
 		LogicalResourceId:  req.LogicalResourceId,
-		Data:               resp.Data,
+		NoEcho:             resp.NoEcho,
+		Data:               data,
 	}
-	return h.reply(ctx, req, &input)
+	return &input
 }
 
-func (h *Handler) replyFailure(ctx context.Context, req *Request, reason string) error {
-	fmt.Fprintf(h.output, "%v: %v failed - %v\n", req.LogicalResourceId, req.RequestType, reason)
-	input := replyInput{
-		Status: StatusFailed,
-		Reason: reason,
+// isReplacement returns true if resp replaces the resource being updated;
+// CloudFormation will subsequently Delete the old PhysicalResourceId
+func (h *Handler) isReplacement(req *Request, resp *Response) bool {
+	if req.RequestType != RequestTypeUpdate || req.PhysicalResourceId == "" {
+		return false
+	}
+	if h.physicalIDEqual != nil {
+		return !h.physicalIDEqual(req.PhysicalResourceId, resp.PhysicalResourceId)
 	}
-	return h.reply(ctx, req, &input)
+	return req.PhysicalResourceId != resp.PhysicalResourceId
+}
+
+// newFailureReply returns the reply for a failed Func; physicalID is the
+// PhysicalResourceId to reply with, see failurePhysicalID
+func (h *Handler) newFailureReply(ctx context.Context, req *Request, physicalID, reason string) *ReplyInput {
+	var suffix string
+	if h.logLink {
+		if link := logLink(ctx); link != "" {
+			suffix = " (logs: " + link + ")"
+		}
+		if len(suffix) >= h.maxReasonLength {
+			suffix = "" // leave room for the reason itself
+		}
+	}
+	reason = truncateReason(reason, h.maxReasonLength-len(suffix)) + suffix
+	h.logf(LogError, req, "%v: %v failed - %v\n", req.LogicalResourceId, req.RequestType, reason)
+	input := ReplyInput{
+		Status:             StatusFailed,
+		Reason:             reason,
+		PhysicalResourceId: physicalID,
+		StackId:            req.StackId,
+		RequestId:          req.RequestId,
+		LogicalResourceId:  req.LogicalResourceId,
+	}
+	return &input
+}
+
+// logEnabled returns true if events at level should be logged
+func (h *Handler) logEnabled(level LogLevel) bool {
+	if !h.logging || level < h.logLevel {
+		return false
+	}
+	if t, ok := h.logger.(*textLogger); ok {
+		return t.writer(level) != ioutil.Discard
+	}
+	return true
+}
+
+// logf sends the formatted message, along with the ids of req, if any, to
+// the Logger.  When logging is disabled or level is below the minimum, logf
+// returns without formatting.
+func (h *Handler) logf(level LogLevel, req *Request, format string, args ...interface{}) {
+	if !h.logEnabled(level) {
+		return
+	}
+
+	msg := strings.TrimSuffix(fmt.Sprintf(format, args...), "\n")
+	var kv []interface{}
+	if req != nil {
+		kv = []interface{}{
+			"logicalResourceId", req.LogicalResourceId,
+			"requestType", req.RequestType,
+			"requestId", req.RequestId,
+		}
+		if id := OperationID(req); id != "" {
+			kv = append(kv, "operationId", id)
+		}
+	}
+
+	switch level {
+	case LogDebug:
+		h.logger.Debug(msg, kv...)
+	case LogInfo:
+		h.logger.Info(msg, kv...)
+	case LogWarn:
+		h.logger.Warn(msg, kv...)
+	default:
+		h.logger.Error(msg, kv...)
+	}
+}
+
+type handlerKey struct{}
+
+// logf logs via the Handler invoking the Func, if any, so helpers called
+// from within a Func can log alongside the Handler
+func logf(ctx context.Context, level LogLevel, format string, args ...interface{}) {
+	if h, ok := ctx.Value(handlerKey{}).(*Handler); ok && h.logEnabled(level) {
+		md, _ := MetadataFromContext(ctx)
+		req := &Request{
+			LogicalResourceId:  md.LogicalResourceId,
+			RequestType:        md.RequestType,
+			RequestId:          md.RequestId,
+			ClientRequestToken: md.OperationId,
+		}
+		h.logf(level, req, format, args...)
+	}
+}
+
+// panicError wraps the value recovered from a panicking Func
+type panicError struct {
+	error
+	// stack is the full stack trace of the panicking goroutine
+	stack []byte
+	// frames are the innermost frames, outside the runtime, that panicked
+	frames []string
+}
+
+func (p panicError) Unwrap() error {
+	return p.error
+}
+
+// maxPanicFrames is the number of frames included in the failure reason
+const maxPanicFrames = 3
+
+// panicFrames returns the innermost frames of the panicking goroutine,
+// excluding those within the runtime, formatted as func (file:line).  Must
+// be called from the deferred func that recovered.
+func panicFrames() []string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var names []string
+	for len(names) < maxPanicFrames {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "runtime.") {
+			names = append(names, fmt.Sprintf("%v (%v:%v)", frame.Function, filepath.Base(frame.File), frame.Line))
+		}
+		if !more {
+			break
+		}
+	}
+	return names
+}
+
+// recoverPanic assigns a panicError to err if the caller is panicking.  Must
+// be deferred directly.
+func recoverPanic(err *error) {
+	if r := recover(); r != nil {
+		v, ok := r.(error)
+		if !ok {
+			v = fmt.Errorf("recovered from %v", r)
+		}
+		*err = panicError{error: v, stack: debug.Stack(), frames: panicFrames()}
+	}
+}
+
+// safeMatch calls the user supplied match, e.g. WithSuccessOnError, with
+// target, returning a panicError if match panics
+func safeMatch(match func(error) bool, target error) (ok bool, err error) {
+	defer recoverPanic(&err)
+	return match(target), nil
 }
 
 func (h *Handler) safeInvoke(ctx context.Context, req *Request) (resp *Response, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			if v, ok := r.(error); ok {
-				err = v
-				return
-			}
+	defer recoverPanic(&err)
 
-			err = fmt.Errorf("recovered from %v", r)
+	if h.chaos != nil && h.chaos.Handler {
+		if err := h.chaos.inject(ctx); err != nil {
+			return nil, err
 		}
-	}()
+	}
 
 	return h.fn(ctx, req)
 }
 
+// attempt calls the Func, retrying upstream timeouts if configured.  An
+// upstream timeout is a context.DeadlineExceeded error returned while ctx
+// itself has not yet expired.
+func (h *Handler) attempt(ctx context.Context, req *Request) (*Response, error) {
+	resp, err := h.safeInvoke(ctx, req)
+	if _, ok := err.(panicError); ok && h.recoverRetry != nil && ctx.Err() == nil {
+		h.logf(LogError, req, "%v: %v panicked, retrying once - %v\n", req.LogicalResourceId, req.RequestType, err)
+		for _, reset := range h.recoverRetry {
+			reset()
+		}
+		resp, err = h.safeInvoke(ctx, req)
+	}
+	for i := 0; i < h.timeoutRetries && errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil; i++ {
+		h.logf(LogWarn, req, "%v: %v timed out, retrying - %v\n", req.LogicalResourceId, req.RequestType, err)
+		resp, err = h.safeInvoke(ctx, req)
+	}
+	return resp, err
+}
+
+// invokeDelete retries the delete while the resource is reported as busy
+func (h *Handler) invokeDelete(ctx context.Context, req *Request) (*Response, error) {
+	retry := h.deleteRetry
+	resp, err := h.attempt(ctx, req)
+	for attempt := 1; err != nil && retry.isBusy != nil && attempt < retry.attempts; attempt++ {
+		busy, matchErr := safeMatch(retry.isBusy, err)
+		if matchErr != nil {
+			return nil, matchErr
+		}
+		if !busy {
+			break
+		}
+
+		h.logf(LogWarn, req, "%v: %v busy, retrying in %v - %v\n", req.LogicalResourceId, req.RequestType, retry.backoff, err)
+
+		if h.clock.Sleep(ctx, retry.backoff) != nil {
+			return nil, err
+		}
+
+		resp, err = h.attempt(ctx, req)
+	}
+	return resp, err
+}
+
+// requireTLS returns an error unless responseURL uses https
+func requireTLS(responseURL string) error {
+	u, err := url.Parse(responseURL)
+	if err != nil {
+		return fmt.Errorf("unable to parse ResponseURL: %v", err)
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("ResponseURL must use https; got %v", u.Scheme)
+	}
+	return nil
+}
+
+// invoke calls the Func for the request type
+func (h *Handler) invoke(ctx context.Context, req *Request) (resp *Response, err error) {
+	if req.RequestType == RequestTypeDelete && neverCreated(req.PhysicalResourceId) {
+		h.logf(LogInfo, req, "%v: %v skipped; resource was never created\n", req.LogicalResourceId, req.RequestType)
+		return &Response{PhysicalResourceId: req.PhysicalResourceId}, nil
+	}
+
+	if h.distributedLock != nil {
+		release, err := h.acquireLock(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
+	if h.idempotency != nil {
+		reply, err := h.idempotency.Load(req.RequestId)
+		if err != nil {
+			return nil, fmt.Errorf("unable to check whether RequestId %v was processed: %v", req.RequestId, err)
+		}
+		if reply != nil {
+			h.logf(LogWarn, req, "%v: %v skipped; RequestId %v already processed\n", req.LogicalResourceId, req.RequestType, req.RequestId)
+			return replay(reply), nil
+		}
+	}
+
+	if req.RequestType == RequestTypeDelete {
+		resp, err = h.invokeDelete(ctx, req)
+	} else {
+		resp, err = h.attempt(ctx, req)
+	}
+
+	if err != nil && h.successOnError != nil {
+		ok, matchErr := safeMatch(h.successOnError, err)
+		if matchErr != nil {
+			return nil, matchErr
+		}
+		if ok {
+			h.logf(LogWarn, req, "%v: %v error treated as success - %v\n", req.LogicalResourceId, req.RequestType, err)
+			return &Response{PhysicalResourceId: h.physicalResourceID(req)}, nil
+		}
+	}
+
+	if err == nil && h.createVerify != nil && req.RequestType == RequestTypeCreate && resp != nil && resp.responder == nil {
+		// verify the id that will be sent, even if the Func relies on the default
+		h.fillPhysicalID(req, resp)
+		if err := h.verifyCreate(ctx, req, resp); err != nil {
+			return resp, err
+		}
+	}
+
+	return resp, err
+}
+
+// validateRequest verifies the incoming Request prior to calling the Func
+func (h *Handler) validateRequest(ctx context.Context, req *Request) error {
+	if !IsValidRequestType(req.RequestType) {
+		return fmt.Errorf("invalid RequestType, %q; expected one of %v", req.RequestType, strings.Join(RequestTypes, ", "))
+	}
+	if h.minRemainingTime > 0 {
+		if remaining, ok := h.remainingTime(ctx); ok && remaining < h.minRemainingTime {
+			return errInsufficientTime
+		}
+	}
+	if h.validateServiceToken {
+		if err := validateServiceToken(ctx, req); err != nil {
+			return err
+		}
+	}
+	if h.recursionGuard != nil {
+		if err := h.checkRecursion(ctx, req); err != nil {
+			return err
+		}
+	}
+	if h.validateResourceType && !isCustomResourceType(req.ResourceType) {
+		return fmt.Errorf("invalid ResourceType, %q; expected Custom::<name> or %v", req.ResourceType, resourceTypeCustomResource)
+	}
+	if h.validateRequestId && !reRequestId.MatchString(req.RequestId) {
+		return fmt.Errorf("invalid RequestId, %q; expected a non-empty token", req.RequestId)
+	}
+	if h.propertySchema != nil && req.RequestType != RequestTypeDelete {
+		if err := h.propertySchema.validate(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reRequestId leniently matches request ids; CloudFormation uses uuids, but
+// any reasonable token without whitespace is accepted
+var reRequestId = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:/+=-]{0,255}$`)
+
+// resourceTypeCustomResource is the built in custom resource type
+const resourceTypeCustomResource = "AWS::CloudFormation::CustomResource"
+
+// isCustomResourceType returns true if resourceType names a custom resource
+func isCustomResourceType(resourceType string) bool {
+	if resourceType == resourceTypeCustomResource {
+		return true
+	}
+	return strings.HasPrefix(resourceType, "Custom::") && len(resourceType) > len("Custom::")
+}
+
+// validateResponse verifies the Response returned by the Func prior to replying
+func (h *Handler) validateResponse(req *Request, resp *Response) error {
+	if h.strictPhysicalID && req.RequestType == RequestTypeCreate && resp.PhysicalResourceId == "" {
+		return fmt.Errorf("handler returned empty PhysicalResourceId on Create")
+	}
+	if resp.PhysicalResourceId != req.PhysicalResourceId && neverCreated(resp.PhysicalResourceId) {
+		return fmt.Errorf("handler returned PhysicalResourceId %q; the prefix %v is reserved", resp.PhysicalResourceId, failedCreatePrefix)
+	}
+	if h.physicalIDValidator != nil && resp.PhysicalResourceId != "" {
+		if err := h.physicalIDValidator(resp.PhysicalResourceId); err != nil {
+			return fmt.Errorf("handler returned invalid PhysicalResourceId %q: %v", resp.PhysicalResourceId, err)
+		}
+	}
+	if resp.RawData != nil && !isJSONObject(resp.RawData) {
+		return fmt.Errorf("handler returned RawData that is not a json object")
+	}
+	if h.outputSchema != nil {
+		if err := h.outputSchema.validate(resp); err != nil {
+			return err
+		}
+	}
+
+	// the limits apply to the Data as sent, version included
+	sent := resp.Data
+	if h.outputSchema != nil && resp.RawData == nil {
+		sent = h.outputSchema.inject(resp.Data)
+	}
+	if h.maxDataAttributes > 0 && len(sent) > h.maxDataAttributes {
+		return fmt.Errorf("handler returned %v Data attributes; at most %v are allowed", len(sent), h.maxDataAttributes)
+	}
+	if h.maxDataSize > 0 && (sent != nil || resp.RawData != nil) {
+		data := []byte(resp.RawData)
+		if data == nil {
+			var err error
+			if data, err = json.Marshal(sent); err != nil {
+				return fmt.Errorf("unable to encode Data: %v", err)
+			}
+		}
+		if len(data) > h.maxDataSize {
+			return fmt.Errorf("handler returned %v bytes of Data; at most %v bytes are allowed", len(data), h.maxDataSize)
+		}
+	}
+	if h.requireNonEmptyData {
+		if keys := emptyDataKeys(resp.Data); len(keys) > 0 {
+			return fmt.Errorf("handler returned empty Data values for keys: %v", strings.Join(keys, ", "))
+		}
+	}
+	return nil
+}
+
+// checkResponse verifies the Response returned by the Func is internally
+// consistent
+func checkResponse(resp *Response) error {
+	if resp == nil {
+		return fmt.Errorf("handler returned a nil Response without an error")
+	}
+	if resp.responder != nil {
+		var fields []string
+		if resp.PhysicalResourceId != "" {
+			fields = append(fields, "PhysicalResourceId")
+		}
+		if resp.Data != nil {
+			fields = append(fields, "Data")
+		}
+		if resp.RawData != nil {
+			fields = append(fields, "RawData")
+		}
+		if resp.NoEcho {
+			fields = append(fields, "NoEcho")
+		}
+		if resp.Reason != "" {
+			fields = append(fields, "Reason")
+		}
+		if len(fields) > 0 {
+			return fmt.Errorf("handler returned a Response built by Respond that also sets %v; set them on the ReplyInput instead", strings.Join(fields, ", "))
+		}
+	}
+	return nil
+}
+
+// isJSONObject returns true if data is a valid json object
+func isJSONObject(data json.RawMessage) bool {
+	var v map[string]json.RawMessage
+	return json.Unmarshal(data, &v) == nil && v != nil
+}
+
+// emptyDataKeys returns the sorted keys in data whose values are not
+// non-empty strings
+func emptyDataKeys(data map[string]interface{}) []string {
+	var keys []string
+	for k, v := range data {
+		if s, ok := v.(string); !ok || s == "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // Invoke implements lambda.Handler
 func (h *Handler) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	_, err := h.Process(ctx, payload)
+	return nil, err
+}
+
+// accept logs the receipt of req and returns an error if req must be
+// rejected without a reply
+func (h *Handler) accept(req *Request) error {
+	h.logf(LogDebug, req, "%v: %v received. RequestId=%v\n", req.LogicalResourceId, req.RequestType, req.RequestId)
+	if h.requireTLS {
+		if err := requireTLS(req.ResponseURL); err != nil {
+			h.logf(LogError, req, "%v: %v rejected - %v\n", req.LogicalResourceId, req.RequestType, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// dispatch calls the Func for req and returns the reply to send along with
+// the error, if any, that caused a FAILED reply.  If the Func is not ready and
+// WithReinvoke was specified, the reply is nil and the error ErrNotReady.
+func (h *Handler) dispatch(ctx context.Context, req *Request) (*ReplyInput, error) {
+	var (
+		parent = ctx
+		resp   *Response
+		err    error
+		acc    = &accumulator{}
+		route  *routeTrace
+	)
+	if ctxErr := ctx.Err(); ctxErr != nil && h.canceledReplyTimeout > 0 {
+		err = fmt.Errorf("invoked with a done context: %v", ctxErr)
+	}
+	if err == nil {
+		ctx = context.WithValue(ctx, idempotencyTokenKey{}, h.idempotencyToken(req))
+		ctx = context.WithValue(ctx, MetadataKey, newMetadata(req))
+		ctx = context.WithValue(ctx, accumulatorKey{}, acc)
+		if h.routeTracing {
+			route = &routeTrace{}
+			ctx = context.WithValue(ctx, routeKey{}, route)
+		}
+		if h.logging {
+			ctx = context.WithValue(ctx, handlerKey{}, h)
+		}
+		err = h.validateRequest(ctx, req)
+	}
+	if err == nil {
+		resp, err = h.invokeWatched(ctx, req)
+	}
+	if route != nil {
+		branch := route.String()
+		if branch == "" {
+			branch = funcName(h.fn)
+		}
+		h.logf(LogInfo, req, "%v: route resourceType=%v requestType=%v branch=%v\n", req.LogicalResourceId, req.ResourceType, req.RequestType, branch)
+	}
+
+	if err == nil {
+		err = checkResponse(resp)
+	}
+
+	var custom *ReplyInput
+	if err == nil && resp.responder != nil {
+		custom, err = resp.responder.BuildReply(req)
+		if _, replayed := resp.responder.(replayResponder); err == nil && !replayed {
+			err = h.checkReply(req, custom)
+		}
+	} else if err == nil {
+		resp.Data = acc.merge(resp.Data)
+		h.fillPhysicalID(req, resp)
+		err = h.validateResponse(req, resp)
+	}
+
+	if err != nil && h.reinvoker != nil && errors.Is(err, ErrNotReady) {
+		return nil, err
+	}
+
+	var input *ReplyInput
+	if err != nil {
+		input = h.newFailureReply(parent, req, h.failurePhysicalID(req, resp, err), h.reason(req, err))
+		if _, ok := err.(panicError); ok && h.partialDataOnPanic {
+			if data := acc.snapshot(); data != nil {
+				input.Data = data
+			}
+		}
+	} else if custom != nil {
+		input = custom
+	} else {
+		input = h.newSuccessReply(req, resp)
+	}
+
+	return input, err
+}
+
+// Dispatch processes req just as Invoke does, but returns the reply rather
+// than sending it to the ResponseURL; a test seam for Funcs and a driver for
+// running them locally.  Only the reply is computed; metrics, archives, and
+// summary lines are not produced.  The error is non-nil only if req was
+// rejected without a reply e.g. by WithRequireTLS.
+func (h *Handler) Dispatch(ctx context.Context, req *Request) (*ReplyInput, error) {
+	if h.coalescers != nil {
+		defer h.flushLogs()
+	}
+
+	if err := h.accept(req); err != nil {
+		return nil, err
+	}
+	input, err := h.dispatch(ctx, req)
+	if input == nil {
+		// not ready; Dispatch does not reinvoke
+		input = h.newFailureReply(ctx, req, h.failurePhysicalID(req, nil, err), h.reason(req, err))
+	}
+	return input, nil
+}
+
+// Result describes the outcome of processing a request
+type Result struct {
+	// Status of the reply, SUCCESS or FAILED, or StatusReinvoked if no reply was
+	// sent as the request was rescheduled
+	Status string
+	// PhysicalResourceId sent with the reply
+	PhysicalResourceId string
+	// Data sent with the reply
+	Data interface{}
+	// Reason sent with the reply
+	Reason string
+	// Delivered is true if the reply was accepted by the ResponseURL
+	Delivered bool
+	// Reinvoked is true if the Func returned ErrNotReady and the request was
+	// rescheduled rather than replied to
+	Reinvoked bool
+}
+
+// Process handles the request, encoded in payload, just as Invoke does, but
+// returns the outcome for callers outside of Lambda.  The error is non-nil
+// only if the request could not be processed or the reply could not be
+// sent, in which case the Result may be nil.
+func (h *Handler) Process(ctx context.Context, payload []byte) (*Result, error) {
+	if h.coalescers != nil {
+		defer h.flushLogs()
+	}
+
+	if h.snsEnvelope {
+		var err error
+		if payload, err = unwrapSNS(payload); err != nil {
+			return nil, err
+		}
+	}
+
 	var req Request
 	if err := json.Unmarshal(payload, &req); err != nil {
 		return nil, err
 	}
+	if err := h.accept(&req); err != nil {
+		return nil, err
+	}
 
-	resp, err := h.safeInvoke(ctx, &req)
-	if err != nil {
-		reason := err.Error()
-		return nil, h.replyFailure(ctx, &req, reason)
+	var (
+		started  = h.clock.Now()
+		cold     = takeColdStart()
+		parent   = ctx
+		replyCtx context.Context
+	)
+	if cold && h.coldStart {
+		h.logf(LogInfo, &req, "%v: %v coldStart=true\n", req.LogicalResourceId, req.RequestType)
+	}
+	if ctx.Err() != nil && h.canceledReplyTimeout > 0 {
+		// the reply would fail immediately with ctx so reply with a fresh one
+		c, cancel := context.WithTimeout(context.Background(), h.canceledReplyTimeout)
+		defer cancel()
+		replyCtx = c
+	}
+
+	input, err := h.dispatch(ctx, &req)
+	var reinvoked bool
+	if input == nil {
+		// not ready; reschedule rather than reply
+		if reinvokeErr := h.reinvoke(ctx, &req); reinvokeErr != nil {
+			input = h.newFailureReply(parent, &req, h.failurePhysicalID(&req, nil, err), h.reason(&req, reinvokeErr))
+		} else {
+			input, reinvoked = newReinvokedReply(&req), true
+		}
+	}
+	if h.metrics != nil {
+		labels := map[string]string{"requestType": req.RequestType, "status": input.Status}
+		h.metrics.Observe(metricRequestDuration, h.clock.Now().Sub(started).Seconds(), labels)
+	}
+
+	if replyCtx == nil {
+		replyCtx = parent
+		if h.replyContext != nil {
+			c, cancel := h.replyContext(parent)
+			defer cancel()
+			replyCtx = c
+		}
+	}
+
+	var (
+		replyStatus = reinvokedReplyStatus
+		replyCode   int
+		replyErr    error
+	)
+	if !reinvoked {
+		replyStatus, replyCode, replyErr = h.reply(replyCtx, &req, input)
+	}
+	if h.lastReply != nil {
+		h.lastReply.store(input)
+	}
+	if h.idempotency != nil && replyErr == nil && replyCode/100 == 2 {
+		h.recordReply(&req, input)
+	}
+	if h.noOpUpdateReplay != nil && replyErr == nil && replyCode/100 == 2 {
+		h.recordReplay(replyCtx, &req, input)
+	}
+	if h.metrics != nil && replyErr == nil && replyCode/100 == 2 {
+		elapsed := h.clock.Now().Sub(started)
+		labels := map[string]string{"requestType": req.RequestType}
+		if h.coldStart {
+			labels["coldStart"] = strconv.FormatBool(cold)
+		}
+		h.metrics.Observe(metricTimeToReply, elapsed.Seconds(), labels)
+	}
+
+	if h.localStats != nil {
+		h.localStats.record(req.RequestType, input.Status, h.clock.Now().Sub(started))
+	}
+
+	if h.archive != nil {
+		if err := h.archive.store(replyCtx, &req, input, err, started); err != nil {
+			h.logf(LogWarn, &req, "%v: unable to archive outcome - %v\n", req.LogicalResourceId, err)
+		}
 	}
 
-	return nil, h.replySuccess(ctx, &req, resp)
+	if h.summaryLine && h.logEnabled(LogInfo) {
+		outcome := input.Status
+		if _, ok := err.(panicError); ok {
+			outcome = outcomePanic
+		}
+		if replyErr != nil {
+			replyStatus = replyErr.Error()
+		}
+		data, err := json.Marshal(summary{
+			Event:              "summary",
+			LogicalResourceId:  req.LogicalResourceId,
+			RequestType:        req.RequestType,
+			RequestId:          req.RequestId,
+			Outcome:            outcome,
+			DurationMs:         h.clock.Now().Sub(started).Milliseconds(),
+			PhysicalResourceId: input.PhysicalResourceId,
+			ReplyStatus:        replyStatus,
+		})
+		if err != nil {
+			h.logf(LogWarn, &req, "%v: unable to encode summary - %v\n", req.LogicalResourceId, err)
+		} else {
+			h.logf(LogInfo, &req, "%s\n", data)
+		}
+	}
+
+	if h.postReplyGrace > 0 && replyErr == nil {
+		// give background work a chance to complete before the Lambda freezes
+		h.clock.Sleep(parent, h.postReplyGrace)
+	}
+
+	result := Result{
+		Status:             input.Status,
+		PhysicalResourceId: input.PhysicalResourceId,
+		Data:               input.Data,
+		Reason:             input.Reason,
+		Delivered:          replyErr == nil && replyCode/100 == 2,
+		Reinvoked:          reinvoked,
+	}
+	return &result, replyErr
 }
 
 type options struct {
-	output    io.Writer
-	transport http.RoundTripper
+	output               io.Writer
+	transport            http.RoundTripper
+	encoder              ReplyEncoder
+	deleteRetry          deleteRetry
+	summaryLine          bool
+	strictPhysicalID     bool
+	chaos                *ChaosConfig
+	validateServiceToken bool
+	successOnError       func(error) bool
+	errorReasons         []errorReason
+	canceledReplyTimeout time.Duration
+	sensitiveKeys        map[string]struct{}
+	requireTLS           bool
+	timeoutRetries       int
+	requireNonEmptyData  bool
+	idempotencyTokenKey  string
+	archive              *archive
+	replyContext         func(context.Context) (context.Context, context.CancelFunc)
+	validateResourceType bool
+	physicalIDEqual      func(old, new string) bool
+	replyRetry           replyRetry
+	metrics              MetricsCollector
+	replyContentType     string
+	awsErrorReasons      bool
+	maxDataAttributes    int
+	recoverRetry         []func()
+	clock                clock
+	postReplyGrace       time.Duration
+	reasonNewline        string
+	outputSchema         *outputSchema
+	recursionGuard       *recursionGuard
+	logLevel             LogLevel
+	random               *rand.Rand
+	partialDataOnPanic   bool
+	physicalIDValidator  func(string) error
+	routeTracing         bool
+	memoryWatchdog       *memoryWatchdog
+	metricsSnapshot      bool
+	minRemainingTime     time.Duration
+	distributedLock      *distributedLock
+	errorOutput          io.Writer
+	timeoutBuffer        time.Duration
+	validateRequestId    bool
+	coalesceLogs         bool
+	physicalIDKey        string
+	createVerify         func(context.Context, *Request, *Response) error
+	logger               Logger
+	maxDataSize          int
+	maxReasonLength      int
+	coldStart            bool
+	physicalResourceID   func(*Request) string
+	transportWrappers    []TransportWrapper
+	middleware           []Middleware
+	noOpUpdateReplay     ReplayStore
+	logLink              bool
+	idempotency          IdempotencyStore
+	propertySchema       *propertySchema
+	replyTimeout         time.Duration
+	dryRun               bool
+	reasonFormatter      func(*Request, error) string
+	snsEnvelope          bool
+	reinvoker            Reinvoker
+	gzip                 bool
+	retainReply          bool
+	httpClient           *http.Client
 }
 
 // Option functional option for the Handler
@@ -173,28 +1136,395 @@ func WithOutput(w io.Writer) Option {
 	}
 }
 
-// WithTransport allows the transport to be customized
+// WithErrorOutput writes error events, e.g. failures and panics, to w rather
+// than the output specified by WithOutput e.g. to alert off of stderr
+func WithErrorOutput(w io.Writer) Option {
+	return func(o *options) {
+		if w != nil {
+			o.errorOutput = w
+		}
+	}
+}
+
+// WithTransport allows the transport to be customized.  WithTransport and
+// WithHTTPClient are mutually exclusive; the last one specified wins.
 func WithTransport(transport http.RoundTripper) Option {
 	return func(o *options) {
 		if transport != nil {
 			o.transport = transport
+			o.httpClient = nil
+		}
+	}
+}
+
+// WithHTTPClient sends the reply via client, honoring its timeout and
+// redirect policy, rather than via a bare transport.  The client is copied so
+// transport wrappers may be applied without modifying it.  WithTransport and
+// WithHTTPClient are mutually exclusive; the last one specified wins.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		if client != nil {
+			o.httpClient = client
+			o.transport = http.DefaultTransport
+		}
+	}
+}
+
+// WithReplyEncoder allows the serialization of the reply to be customized
+func WithReplyEncoder(encoder ReplyEncoder) Option {
+	return func(o *options) {
+		if encoder != nil {
+			o.encoder = encoder
+		}
+	}
+}
+
+// WithReplyContentType sends the reply with the specified Content-Type.  By
+// default, no Content-Type is sent as the presigned S3 url provided by
+// CloudFormation is signed without one; only set this when targeting a
+// compatible, non-S3, endpoint.
+func WithReplyContentType(contentType string) Option {
+	return func(o *options) {
+		o.replyContentType = contentType
+	}
+}
+
+// WithDeleteRetryWhile retries Delete requests, up to attempts times in total,
+// while isBusy reports the error as a transient in-use condition.  Retries
+// stop early if the context is done.
+func WithDeleteRetryWhile(isBusy func(error) bool, attempts int, backoff time.Duration) Option {
+	return func(o *options) {
+		o.deleteRetry = deleteRetry{
+			isBusy:   isBusy,
+			attempts: attempts,
+			backoff:  backoff,
+		}
+	}
+}
+
+// WithSuccessOnErrors replies SUCCESS when the Func returns an error matched
+// by predicate e.g. a resource that already exists on Create.  The error is
+// logged and the PhysicalResourceId from the request, or a deterministic one
+// for Create, is used.
+func WithSuccessOnErrors(predicate func(error) bool) Option {
+	return func(o *options) {
+		o.successOnError = predicate
+	}
+}
+
+// WithCanceledContextReply replies FAILED, without calling the Func, when
+// Invoke is called with a context that is already done.  The reply uses a
+// fresh context bounded by timeout so CloudFormation still receives a
+// response.  The trade-off is that the reply may outlive the cancellation
+// requested by the caller by up to timeout.
+func WithCanceledContextReply(timeout time.Duration) Option {
+	return func(o *options) {
+		o.canceledReplyTimeout = timeout
+	}
+}
+
+// WithRequireTLS rejects requests whose ResponseURL is not https.  No reply
+// is sent as the ResponseURL is not trusted; instead Invoke returns an error.
+//
+// To test with this option enabled, use httptest.NewTLSServer and pass the
+// server's transport via WithTransport(server.Client().Transport).
+func WithRequireTLS() Option {
+	return func(o *options) {
+		o.requireTLS = true
+	}
+}
+
+// WithRetryOnTimeout retries the Func, up to attempts additional times, when
+// it returns a context.DeadlineExceeded error from an upstream call.  Retries
+// stop once the invocation context is done so the Lambda deadline is always
+// respected.
+func WithRetryOnTimeout(attempts int) Option {
+	return func(o *options) {
+		o.timeoutRetries = attempts
+	}
+}
+
+// WithRequireNonEmptyData replies FAILED unless every value in Data is a
+// non-empty string, listing the offending keys
+func WithRequireNonEmptyData() Option {
+	return func(o *options) {
+		o.requireNonEmptyData = true
+	}
+}
+
+// WithReplyContext derives the context used to send the reply from the
+// context passed to Invoke.  This allows the reply to proceed, for example
+// with a fresh bounded context, even if the parent context has been canceled.
+// By default, the reply uses the parent context.
+func WithReplyContext(fn func(parent context.Context) (context.Context, context.CancelFunc)) Option {
+	return func(o *options) {
+		o.replyContext = fn
+	}
+}
+
+// WithValidateResourceTypeFormat replies FAILED unless the ResourceType is
+// either Custom::<name> or AWS::CloudFormation::CustomResource
+func WithValidateResourceTypeFormat() Option {
+	return func(o *options) {
+		o.validateResourceType = true
+	}
+}
+
+// WithValidateRequestId replies FAILED unless the RequestId is a non-empty,
+// reasonably formatted, token.  Idempotency and correlation rely on the
+// RequestId.
+func WithValidateRequestId() Option {
+	return func(o *options) {
+		o.validateRequestId = true
+	}
+}
+
+// WithPhysicalIDComparator defines when two physical ids refer to the same
+// resource for the purposes of replacement detection e.g. when ids embed
+// state via EncodeState.  The default is string equality.
+func WithPhysicalIDComparator(equal func(old, new string) bool) Option {
+	return func(o *options) {
+		o.physicalIDEqual = equal
+	}
+}
+
+// WithDryRun, when enabled, calls the Func and computes the reply as usual
+// but logs the reply rather than sending it, e.g. to validate a deployment
+// package against a recorded event without replying to a live ResponseURL
+func WithDryRun(enabled bool) Option {
+	return func(o *options) {
+		o.dryRun = enabled
+	}
+}
+
+// WithReplyTimeout bounds each PUT of the reply to d, independent of the
+// Lambda deadline, so a hung ResponseURL cannot consume the remaining time.
+// Combine with WithReplyRetry to retry after a timeout.
+func WithReplyTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.replyTimeout = d
+	}
+}
+
+// WithReplyRetry retries the PUT of the reply, up to attempts times in
+// total, when it fails.  Retries stop early if the context is done.
+func WithReplyRetry(attempts int, backoff time.Duration) Option {
+	return func(o *options) {
+		o.replyRetry = replyRetry{
+			attempts: attempts,
+			backoff:  backoff,
 		}
 	}
 }
 
+// WithMaxDataAttributes replies FAILED when Data contains more than n keys.
+// By default, the number of attributes is unlimited.
+func WithMaxDataAttributes(n int) Option {
+	return func(o *options) {
+		o.maxDataAttributes = n
+	}
+}
+
+// defaultMaxDataSize is the maximum size of the encoded Data documented by
+// CloudFormation
+const defaultMaxDataSize = 4096
+
+// WithMaxDataSize replies FAILED when the JSON encoded Data exceeds n bytes
+// rather than sending a reply CloudFormation would reject.  Defaults to 4096;
+// n <= 0 disables the check.
+func WithMaxDataSize(n int) Option {
+	return func(o *options) {
+		o.maxDataSize = n
+	}
+}
+
+// WithRecoverRetry retries the Func once if it panics, calling each of the
+// reset funcs beforehand so per-invocation state may be recreated.  The retry
+// is skipped if the context is done.
+//
+// EXPERIMENTAL.  This papers over flaky conditions rather than fixing them.
+func WithRecoverRetry(resets ...func()) Option {
+	return func(o *options) {
+		o.recoverRetry = append([]func(){}, resets...)
+	}
+}
+
+// WithPostReplyGrace waits for d, bounded by the context, after a successful
+// reply before Invoke returns.  This gives background work such as metric
+// flushes a chance to complete before the Lambda container is frozen.
+func WithPostReplyGrace(d time.Duration) Option {
+	return func(o *options) {
+		o.postReplyGrace = d
+	}
+}
+
+// WithSummaryLine writes a single summary line, a json object, to the output
+// at the end of each invocation, regardless of outcome e.g.
+//
+//	{"event":"summary","logicalResourceId":"MyResource","requestType":"Create","requestId":"...","outcome":"SUCCESS","durationMs":42,"physicalResourceId":"abc","replyStatus":"200 OK"}
+func WithSummaryLine() Option {
+	return func(o *options) {
+		o.summaryLine = true
+	}
+}
+
+// WithStrictPhysicalID replies FAILED when the Func returns an empty
+// PhysicalResourceId for a Create request
+func WithStrictPhysicalID() Option {
+	return func(o *options) {
+		o.strictPhysicalID = true
+	}
+}
+
 // New returns a new custom response handler
 func New(fn Func, opts ...Option) *Handler {
 	options := options{
-		output:    ioutil.Discard,
-		transport: http.DefaultTransport,
+		output:             ioutil.Discard,
+		transport:          http.DefaultTransport,
+		encoder:            jsonEncoder{},
+		clock:              realClock{},
+		reasonNewline:      " ",
+		logLevel:           LogInfo,
+		maxDataSize:        defaultMaxDataSize,
+		maxReasonLength:    maxReasonLength,
+		physicalResourceID: defaultPhysicalID,
 	}
 	for _, opt := range opts {
 		opt(&options)
 	}
 
+	for i := len(options.middleware) - 1; i >= 0; i-- {
+		fn = options.middleware[i](fn)
+	}
+	if options.noOpUpdateReplay != nil {
+		fn = noOpUpdateReplay(options.noOpUpdateReplay)(fn)
+	}
+
+	var client *http.Client
+	transport := options.transport
+	if options.httpClient != nil {
+		copied := *options.httpClient
+		client = &copied
+		transport = client.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+	}
+
+	var c *chaos
+	if options.chaos != nil {
+		c = newChaos(*options.chaos, options.random)
+		transport = chaosTransport{chaos: c, transport: transport}
+	}
+	transport = wrapTransport(transport, options.transportWrappers)
+	if client != nil {
+		client.Transport = transport
+	}
+
+	output, errorOutput := options.output, options.errorOutput
+	if errorOutput == nil {
+		errorOutput = output
+	}
+
+	encoder := options.encoder
+	if options.physicalIDKey != "" && options.physicalIDKey != defaultPhysicalIDKey {
+		encoder = physicalIDKeyEncoder{ReplyEncoder: encoder, key: options.physicalIDKey}
+	}
+
+	var coalescers []*coalescer
+	if options.coalesceLogs {
+		if output != ioutil.Discard {
+			c := newCoalescer(output)
+			coalescers = append(coalescers, c)
+			if errorOutput == output {
+				errorOutput = c
+			}
+			output = c
+		}
+		if errorOutput != ioutil.Discard && errorOutput != output {
+			c := newCoalescer(errorOutput)
+			coalescers = append(coalescers, c)
+			errorOutput = c
+		}
+	}
+
+	var logger Logger = &textLogger{output: output, errorOutput: errorOutput}
+	logging := output != ioutil.Discard || errorOutput != ioutil.Discard
+	if options.logger != nil {
+		logger, logging = options.logger, true
+	}
+
+	var stats *localStats
+	if options.metricsSnapshot {
+		stats = newLocalStats()
+	}
+
+	var retained *lastReply
+	if options.retainReply {
+		retained = &lastReply{}
+	}
+
 	return &Handler{
-		fn:        fn,
-		output:    options.output,
-		transport: options.transport,
+		fn:                   fn,
+		logger:               logger,
+		logging:              logging,
+		transport:            transport,
+		encoder:              encoder,
+		deleteRetry:          options.deleteRetry,
+		summaryLine:          options.summaryLine,
+		strictPhysicalID:     options.strictPhysicalID,
+		chaos:                c,
+		validateServiceToken: options.validateServiceToken,
+		successOnError:       options.successOnError,
+		errorReasons:         options.errorReasons,
+		canceledReplyTimeout: options.canceledReplyTimeout,
+		sensitiveKeys:        options.sensitiveKeys,
+		requireTLS:           options.requireTLS,
+		timeoutRetries:       options.timeoutRetries,
+		requireNonEmptyData:  options.requireNonEmptyData,
+		idempotencyTokenKey:  options.idempotencyTokenKey,
+		archive:              options.archive,
+		replyContext:         options.replyContext,
+		validateResourceType: options.validateResourceType,
+		physicalIDEqual:      options.physicalIDEqual,
+		replyRetry:           options.replyRetry,
+		metrics:              options.metrics,
+		replyContentType:     options.replyContentType,
+		awsErrorReasons:      options.awsErrorReasons,
+		maxDataAttributes:    options.maxDataAttributes,
+		recoverRetry:         options.recoverRetry,
+		clock:                options.clock,
+		postReplyGrace:       options.postReplyGrace,
+		reasonNewline:        options.reasonNewline,
+		outputSchema:         options.outputSchema,
+		recursionGuard:       options.recursionGuard,
+		logLevel:             options.logLevel,
+		partialDataOnPanic:   options.partialDataOnPanic,
+		physicalIDValidator:  options.physicalIDValidator,
+		routeTracing:         options.routeTracing,
+		memoryWatchdog:       options.memoryWatchdog,
+		localStats:           stats,
+		minRemainingTime:     options.minRemainingTime,
+		distributedLock:      options.distributedLock,
+		timeoutBuffer:        options.timeoutBuffer,
+		validateRequestId:    options.validateRequestId,
+		coalescers:           coalescers,
+		createVerify:         options.createVerify,
+		maxDataSize:          options.maxDataSize,
+		maxReasonLength:      options.maxReasonLength,
+		coldStart:            options.coldStart,
+		physicalResourceID:   options.physicalResourceID,
+		logLink:              options.logLink,
+		idempotency:          options.idempotency,
+		noOpUpdateReplay:     options.noOpUpdateReplay,
+		propertySchema:       options.propertySchema,
+		replyTimeout:         options.replyTimeout,
+		dryRun:               options.dryRun,
+		reasonFormatter:      options.reasonFormatter,
+		snsEnvelope:          options.snsEnvelope,
+		reinvoker:            options.reinvoker,
+		gzip:                 options.gzip,
+		lastReply:            retained,
+		httpClient:           client,
 	}
 }
@@ -15,15 +15,20 @@
 package customresource
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
 )
@@ -97,7 +102,7 @@ func TestHandler_Invoke(t *testing.T) {
 			t.Fatalf("got %v; want %v", got, want)
 		}
 
-		var input replyInput
+		var input ReplyInput
 		if err := json.Unmarshal(reply, &input); err != nil {
 			t.Fatalf("got %v; want nil", v)
 		}
@@ -122,7 +127,7 @@ func TestHandler_Invoke(t *testing.T) {
 				ResponseURL: "http://localhost",
 			}
 			fn = func(ctx context.Context, req *Request) (*Response, error) {
-				return nil, fmt.Errorf(reason)
+				return nil, errors.New(reason)
 			}
 		)
 
@@ -140,7 +145,7 @@ func TestHandler_Invoke(t *testing.T) {
 			t.Fatalf("got %v; want nil", v)
 		}
 
-		var input replyInput
+		var input ReplyInput
 		if err := json.Unmarshal(reply, &input); err != nil {
 			t.Fatalf("got %v; want nil", v)
 		}
@@ -187,15 +192,1534 @@ func TestHandler_Invoke(t *testing.T) {
 			t.Fatalf("got %v; want nil", v)
 		}
 
-		var input replyInput
+		var input ReplyInput
 		if err := json.Unmarshal(reply, &input); err != nil {
 			t.Fatalf("got %v; want nil", v)
 		}
 		if got, want := input.Status, StatusFailed; got != want {
 			t.Fatalf("got %v; want %v", got, want)
 		}
-		if got, want := input.Reason, "assignment to entry in nil map"; got != want {
+		if got, want := input.Reason, "assignment to entry in nil map at github.com/savaki/customresource.TestHandler_Invoke"; !strings.HasPrefix(got, want) {
+			t.Fatalf("got %v; want prefix %v", got, want)
+		}
+		if got, want := input.Reason, "(handler_test.go:"; !strings.Contains(got, want) {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("panic logs stack", func(t *testing.T) {
+		var (
+			ctx   = context.Background()
+			buf   = &bytes.Buffer{}
+			input ReplyInput
+			fn    = func(ctx context.Context, req *Request) (*Response, error) {
+				panic("boom")
+			}
+		)
+
+		handler := New(fn, WithTransport(captureReply(t, &input)), WithOutput(buf))
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate, LogicalResourceId: "Resource"})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := buf.String(), "Resource: Create panicked - recovered from boom\ngoroutine "; !strings.Contains(got, want) {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := strings.Count(input.Reason, " < "), maxPanicFrames-1; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+}
+
+// captureReply returns a transport that decodes the reply into input
+func captureReply(t *testing.T, input *ReplyInput) transportFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		if err := json.NewDecoder(req.Body).Decode(input); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		w := httptest.NewRecorder()
+		w.WriteHeader(http.StatusOK)
+		return w.Result(), nil
+	}
+}
+
+func marshalRequest(t *testing.T, req Request) []byte {
+	if req.ResponseURL == "" {
+		req.ResponseURL = "http://localhost"
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	return data
+}
+
+func TestWithDeleteRetryWhile(t *testing.T) {
+	var (
+		errBusy = errors.New("busy")
+		isBusy  = func(err error) bool { return err == errBusy }
+	)
+
+	t.Run("busy then ok", func(t *testing.T) {
+		var (
+			ctx   = context.Background()
+			calls int
+			input ReplyInput
+			fn    = func(ctx context.Context, req *Request) (*Response, error) {
+				calls++
+				if calls <= 2 {
+					return nil, errBusy
+				}
+				return &Response{PhysicalResourceId: req.PhysicalResourceId}, nil
+			}
+		)
+
+		handler := New(fn,
+			WithTransport(captureReply(t, &input)),
+			WithDeleteRetryWhile(isBusy, 5, time.Millisecond),
+		)
+		data := marshalRequest(t, Request{RequestType: RequestTypeDelete, PhysicalResourceId: "abc"})
+		if _, err := handler.Invoke(ctx, data); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := calls, 3; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := input.Status, StatusSuccess; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		var (
+			ctx   = context.Background()
+			calls int
+			input ReplyInput
+			fn    = func(ctx context.Context, req *Request) (*Response, error) {
+				calls++
+				return nil, errBusy
+			}
+		)
+
+		handler := New(fn,
+			WithTransport(captureReply(t, &input)),
+			WithDeleteRetryWhile(isBusy, 2, time.Millisecond),
+		)
+		data := marshalRequest(t, Request{RequestType: RequestTypeDelete})
+		if _, err := handler.Invoke(ctx, data); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := calls, 2; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := input.Status, StatusFailed; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("isBusy panics", func(t *testing.T) {
+		var (
+			input ReplyInput
+			fn    = func(ctx context.Context, req *Request) (*Response, error) {
+				return nil, errBusy
+			}
+			isBusy = func(err error) bool { panic("boom") }
+		)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		handler := New(fn,
+			WithTransport(captureReply(t, &input)),
+			WithDeleteRetryWhile(isBusy, 5, time.Millisecond),
+		)
+		data := marshalRequest(t, Request{RequestType: RequestTypeDelete, PhysicalResourceId: "abc"})
+		if _, err := handler.Invoke(ctx, data); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := input.Status, StatusFailed; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if want := "recovered from boom at "; !strings.HasPrefix(input.Reason, want) {
+			t.Fatalf("got %v; want prefix %v", input.Reason, want)
+		}
+	})
+
+	t.Run("create not retried", func(t *testing.T) {
+		var (
+			ctx   = context.Background()
+			calls int
+			input ReplyInput
+			fn    = func(ctx context.Context, req *Request) (*Response, error) {
+				calls++
+				return nil, errBusy
+			}
+		)
+
+		handler := New(fn,
+			WithTransport(captureReply(t, &input)),
+			WithDeleteRetryWhile(isBusy, 5, time.Millisecond),
+		)
+		data := marshalRequest(t, Request{RequestType: RequestTypeCreate})
+		if _, err := handler.Invoke(ctx, data); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := calls, 1; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+}
+
+func TestWithSummaryLine(t *testing.T) {
+	testCases := map[string]struct {
+		Fn      Func
+		Outcome string
+	}{
+		"success": {
+			Fn: func(ctx context.Context, req *Request) (*Response, error) {
+				return &Response{PhysicalResourceId: "abc"}, nil
+			},
+			Outcome: StatusSuccess,
+		},
+		"failure": {
+			Fn: func(ctx context.Context, req *Request) (*Response, error) {
+				return nil, errors.New("boom")
+			},
+			Outcome: StatusFailed,
+		},
+		"panic": {
+			Fn: func(ctx context.Context, req *Request) (*Response, error) {
+				panic("boom")
+			},
+			Outcome: outcomePanic,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx   = context.Background()
+				buf   = bytes.NewBuffer(nil)
+				input ReplyInput
+			)
+
+			handler := New(tc.Fn,
+				WithTransport(captureReply(t, &input)),
+				WithOutput(buf),
+				WithSummaryLine(),
+			)
+			data := marshalRequest(t, Request{RequestType: RequestTypeCreate, LogicalResourceId: "Resource"})
+			if _, err := handler.Invoke(ctx, data); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+
+			output := buf.String()
+			if got, want := strings.Count(output, `"event":"summary"`), 1; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+
+			var line string
+			for _, l := range strings.Split(output, "\n") {
+				if strings.Contains(l, `"event":"summary"`) {
+					line = strings.TrimPrefix(l, "[INFO] ")
+				}
+			}
+			var got summary
+			if err := json.Unmarshal([]byte(line), &got); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := got.Outcome, tc.Outcome; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := got.RequestType, RequestTypeCreate; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := got.LogicalResourceId, "Resource"; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := got.ReplyStatus, "200 OK"; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		var (
+			ctx   = context.Background()
+			buf   = bytes.NewBuffer(nil)
+			input ReplyInput
+			fn    = func(ctx context.Context, req *Request) (*Response, error) {
+				return &Response{}, nil
+			}
+		)
+
+		handler := New(fn, WithTransport(captureReply(t, &input)), WithOutput(buf))
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if strings.Contains(buf.String(), "summary") {
+			t.Fatalf("got %v; want no summary", buf.String())
+		}
+	})
+}
+
+func TestWithStrictPhysicalID(t *testing.T) {
+	testCases := map[string]struct {
+		RequestType string
+		PhysicalID  string
+		Status      string
+	}{
+		"create empty": {
+			RequestType: RequestTypeCreate,
+			Status:      StatusFailed,
+		},
+		"create ok": {
+			RequestType: RequestTypeCreate,
+			PhysicalID:  "abc",
+			Status:      StatusSuccess,
+		},
+		"update empty": {
+			RequestType: RequestTypeUpdate,
+			Status:      StatusSuccess,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx   = context.Background()
+				input ReplyInput
+				fn    = func(ctx context.Context, req *Request) (*Response, error) {
+					return &Response{PhysicalResourceId: tc.PhysicalID}, nil
+				}
+			)
+
+			handler := New(fn, WithTransport(captureReply(t, &input)), WithStrictPhysicalID())
+			if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: tc.RequestType})); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Status, tc.Status; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if tc.Status == StatusFailed {
+				if got, want := input.Reason, "handler returned empty PhysicalResourceId on Create"; got != want {
+					t.Fatalf("got %v; want %v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWithSuccessOnErrors(t *testing.T) {
+	var (
+		errExists   = errors.New("resource already exists")
+		isExists    = func(err error) bool { return err == errExists }
+		errInternal = errors.New("internal error")
+	)
+
+	testCases := map[string]struct {
+		Request    Request
+		Err        error
+		Status     string
+		PhysicalID string
+	}{
+		"create exists": {
+			Request:    Request{RequestType: RequestTypeCreate, StackId: "stack", LogicalResourceId: "Resource"},
+			Err:        errExists,
+			Status:     StatusSuccess,
+			PhysicalID: defaultPhysicalID(&Request{StackId: "stack", LogicalResourceId: "Resource"}),
+		},
+		"update exists": {
+			Request:    Request{RequestType: RequestTypeUpdate, PhysicalResourceId: "abc"},
+			Err:        errExists,
+			Status:     StatusSuccess,
+			PhysicalID: "abc",
+		},
+		"unmatched": {
+			Request:    Request{RequestType: RequestTypeCreate, RequestId: "request-id"},
+			Err:        errInternal,
+			Status:     StatusFailed,
+			PhysicalID: "failed-create-request-id",
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx   = context.Background()
+				buf   = bytes.NewBuffer(nil)
+				input ReplyInput
+				fn    = func(ctx context.Context, req *Request) (*Response, error) {
+					return nil, tc.Err
+				}
+			)
+
+			handler := New(fn, WithTransport(captureReply(t, &input)), WithOutput(buf), WithSuccessOnErrors(isExists))
+			if _, err := handler.Invoke(ctx, marshalRequest(t, tc.Request)); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Status, tc.Status; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := input.PhysicalResourceId, tc.PhysicalID; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if !strings.Contains(buf.String(), tc.Err.Error()) {
+				t.Fatalf("got %v; want error logged", buf.String())
+			}
+		})
+	}
+
+	t.Run("panic", func(t *testing.T) {
+		var (
+			input ReplyInput
+			fn    = func(ctx context.Context, req *Request) (*Response, error) {
+				return nil, errExists
+			}
+			isExists = func(err error) bool { panic("boom") }
+		)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		handler := New(fn, WithTransport(captureReply(t, &input)), WithSuccessOnErrors(isExists))
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate, RequestId: "request-id"})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := input.Status, StatusFailed; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if want := "recovered from boom at "; !strings.HasPrefix(input.Reason, want) {
+			t.Fatalf("got %v; want prefix %v", input.Reason, want)
+		}
+	})
+}
+
+func TestWithCanceledContextReply(t *testing.T) {
+	var (
+		input ReplyInput
+		calls int
+		fn    = func(ctx context.Context, req *Request) (*Response, error) {
+			calls++
+			return &Response{}, nil
+		}
+		rt = func(req *http.Request) (*http.Response, error) {
+			if err := req.Context().Err(); err != nil {
+				return nil, err
+			}
+			return captureReply(t, &input)(req)
+		}
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	handler := New(fn, WithTransport(transportFunc(rt)), WithCanceledContextReply(time.Second))
+	if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := calls, 0; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := input.Status, StatusFailed; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := input.Reason, "invoked with a done context: context canceled"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	// without the option, the reply fails with the canceled context
+	handler = New(fn, WithTransport(transportFunc(rt)))
+	if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err == nil {
+		t.Fatalf("got nil; want err")
+	}
+}
+
+func TestWithRequireTLS(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		invoked bool
+		fn      = func(ctx context.Context, req *Request) (*Response, error) {
+			invoked = true
+			return &Response{PhysicalResourceId: "abc"}, nil
+		}
+	)
+
+	t.Run("http rejected", func(t *testing.T) {
+		var input ReplyInput
+		invoked = false
+
+		handler := New(fn, WithTransport(captureReply(t, &input)), WithRequireTLS())
+		data := marshalRequest(t, Request{RequestType: RequestTypeCreate, ResponseURL: "http://localhost"})
+		if _, err := handler.Invoke(ctx, data); err == nil {
+			t.Fatalf("got nil; want err")
+		}
+		if invoked {
+			t.Fatalf("got true; want false")
+		}
+		if got := input.Status; got != "" {
+			t.Fatalf("got %v; want no reply", got)
+		}
+	})
+
+	t.Run("https allowed", func(t *testing.T) {
+		var input ReplyInput
+		invoked = false
+
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			json.NewDecoder(req.Body).Decode(&input)
+		}))
+		defer server.Close()
+
+		handler := New(fn, WithTransport(server.Client().Transport), WithRequireTLS())
+		data := marshalRequest(t, Request{RequestType: RequestTypeCreate, ResponseURL: server.URL})
+		if _, err := handler.Invoke(ctx, data); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if !invoked {
+			t.Fatalf("got false; want true")
+		}
+		if got, want := input.Status, StatusSuccess; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+}
+
+func TestWithRetryOnTimeout(t *testing.T) {
+	t.Run("timeout then ok", func(t *testing.T) {
+		var (
+			ctx   = context.Background()
+			input ReplyInput
+			calls int
+			fn    = func(ctx context.Context, req *Request) (*Response, error) {
+				calls++
+				if calls == 1 {
+					return nil, fmt.Errorf("upstream call failed: %w", context.DeadlineExceeded)
+				}
+				return &Response{PhysicalResourceId: "abc"}, nil
+			}
+		)
+
+		handler := New(fn, WithTransport(captureReply(t, &input)), WithRetryOnTimeout(1))
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := calls, 2; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := input.Status, StatusSuccess; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("deadline respected", func(t *testing.T) {
+		var (
+			input ReplyInput
+			calls int
+			fn    = func(ctx context.Context, req *Request) (*Response, error) {
+				calls++
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+		)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		handler := New(fn, WithTransport(captureReply(t, &input)), WithRetryOnTimeout(3))
+		handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate}))
+		if got, want := calls, 1; got != want {
 			t.Fatalf("got %v; want %v", got, want)
 		}
 	})
 }
+
+func TestWithRequireNonEmptyData(t *testing.T) {
+	testCases := map[string]struct {
+		Data   map[string]interface{}
+		Status string
+		Reason string
+	}{
+		"populated": {
+			Data:   map[string]interface{}{"Arn": "arn", "Name": "name"},
+			Status: StatusSuccess,
+		},
+		"empty": {
+			Data:   map[string]interface{}{"Arn": "", "Name": "name", "Endpoint": nil},
+			Status: StatusFailed,
+			Reason: "handler returned empty Data values for keys: Arn, Endpoint",
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx   = context.Background()
+				input ReplyInput
+				fn    = func(ctx context.Context, req *Request) (*Response, error) {
+					return &Response{PhysicalResourceId: "abc", Data: tc.Data}, nil
+				}
+			)
+
+			handler := New(fn, WithTransport(captureReply(t, &input)), WithRequireNonEmptyData())
+			if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Status, tc.Status; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := input.Reason, tc.Reason; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
+
+// okTransport discards the reply
+type okTransport struct{}
+
+func (okTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}, nil
+}
+
+func BenchmarkHandler_Invoke(b *testing.B) {
+	var (
+		ctx  = context.Background()
+		resp = &Response{PhysicalResourceId: "abc"}
+		fn   = func(ctx context.Context, req *Request) (*Response, error) {
+			return resp, nil
+		}
+		handler = New(fn, WithTransport(okTransport{}))
+	)
+
+	data, err := json.Marshal(Request{RequestType: RequestTypeCreate, ResponseURL: "http://localhost"})
+	if err != nil {
+		b.Fatalf("got %v; want nil", err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := handler.Invoke(ctx, data); err != nil {
+			b.Fatalf("got %v; want nil", err)
+		}
+	}
+}
+
+// nopWriter discards its input without being ioutil.Discard, so logging
+// remains enabled
+type nopWriter struct{}
+
+func (nopWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func TestHandler_InvokeNoLoggingAllocs(t *testing.T) {
+	var (
+		ctx = context.Background()
+		fn  = func(ctx context.Context, req *Request) (*Response, error) {
+			return &Response{PhysicalResourceId: "abc"}, nil
+		}
+		plain   = New(fn, WithTransport(okTransport{}))
+		quiet   = New(fn, WithTransport(okTransport{}), WithSummaryLine())
+		verbose = New(fn, WithTransport(okTransport{}), WithOutput(nopWriter{}), WithSummaryLine())
+	)
+	if quiet.logging || !verbose.logging {
+		t.Fatalf("got logging %v, %v; want false, true", quiet.logging, verbose.logging)
+	}
+
+	data, err := json.Marshal(Request{RequestType: RequestTypeCreate, ResponseURL: "http://localhost"})
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	invoke := func(h *Handler) func() {
+		return func() { h.Invoke(ctx, data) }
+	}
+	if got, limit := testing.AllocsPerRun(100, invoke(quiet)), testing.AllocsPerRun(100, invoke(verbose)); got >= limit {
+		t.Fatalf("got %v allocs; want fewer than %v", got, limit)
+	}
+	// the summary line costs nothing while logging is disabled
+	if got, limit := testing.AllocsPerRun(100, invoke(quiet)), testing.AllocsPerRun(100, invoke(plain)); got > limit {
+		t.Fatalf("got %v allocs; want at most %v", got, limit)
+	}
+
+	if got := testing.AllocsPerRun(100, func() { quiet.logf(LogInfo, nil, "%v: %v\n", "a", "b") }); got != 0 {
+		t.Fatalf("got %v allocs; want 0", got)
+	}
+}
+
+func TestHandler_EmptyResponseURL(t *testing.T) {
+	var (
+		ctx = context.Background()
+		buf = &bytes.Buffer{}
+		fn  = func(ctx context.Context, req *Request) (*Response, error) {
+			return &Response{PhysicalResourceId: "abc"}, nil
+		}
+		rt = func(req *http.Request) (*http.Response, error) {
+			t.Fatalf("got unexpected request to %v; want none", req.URL)
+			return nil, nil
+		}
+	)
+
+	data, err := json.Marshal(Request{RequestType: RequestTypeCreate, LogicalResourceId: "Resource"})
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	handler := New(fn, WithTransport(transportFunc(rt)), WithOutput(buf))
+	result, err := handler.Process(ctx, data)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := result.Status, StatusSuccess; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if result.Delivered {
+		t.Fatalf("got true; want false")
+	}
+	if got, want := buf.String(), `Resource: no ResponseURL, reply not sent - status=SUCCESS physicalResourceId=abc reason=""`; !strings.Contains(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+func TestHandler_Dispatch(t *testing.T) {
+	var (
+		ctx = context.Background()
+		rt  = func(req *http.Request) (*http.Response, error) {
+			t.Fatalf("got unexpected request to %v; want none", req.URL)
+			return nil, nil
+		}
+		fn = func(ctx context.Context, req *Request) (*Response, error) {
+			if req.RequestType == RequestTypeDelete {
+				return nil, errors.New("boom")
+			}
+			return &Response{PhysicalResourceId: "abc", Data: map[string]interface{}{"Arn": "arn"}}, nil
+		}
+		handler = New(fn, WithTransport(transportFunc(rt)))
+	)
+
+	testCases := map[string]struct {
+		RequestType string
+		Want        ReplyInput
+	}{
+		"success": {
+			RequestType: RequestTypeCreate,
+			Want: ReplyInput{
+				Status:             StatusSuccess,
+				PhysicalResourceId: "abc",
+				RequestId:          "request-id",
+				LogicalResourceId:  "Resource",
+				Data:               map[string]interface{}{"Arn": "arn"},
+			},
+		},
+		"failure": {
+			RequestType: RequestTypeDelete,
+			Want: ReplyInput{
+				Status:             StatusFailed,
+				Reason:             "boom",
+				PhysicalResourceId: "abc",
+				RequestId:          "request-id",
+				LogicalResourceId:  "Resource",
+			},
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			req := &Request{
+				RequestType:        tc.RequestType,
+				RequestId:          "request-id",
+				LogicalResourceId:  "Resource",
+				PhysicalResourceId: "abc",
+				ResponseURL:        "http://localhost",
+			}
+			got, err := handler.Dispatch(ctx, req)
+			if err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if want := &tc.Want; !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %#v; want %#v", got, want)
+			}
+		})
+	}
+
+	t.Run("rejected", func(t *testing.T) {
+		handler := New(fn, WithTransport(transportFunc(rt)), WithRequireTLS())
+		if _, err := handler.Dispatch(ctx, &Request{RequestType: RequestTypeCreate, ResponseURL: "http://localhost"}); err == nil {
+			t.Fatalf("got nil; want err")
+		}
+	})
+}
+
+func TestWithReplyTimeout(t *testing.T) {
+	var (
+		ctx = context.Background()
+		buf = &bytes.Buffer{}
+		rt  = func(req *http.Request) (*http.Response, error) {
+			<-req.Context().Done() // a hung ResponseURL
+			return nil, req.Context().Err()
+		}
+		fn = func(ctx context.Context, req *Request) (*Response, error) {
+			return &Response{PhysicalResourceId: "abc"}, nil
+		}
+		timeout = 20 * time.Millisecond
+	)
+
+	handler := New(fn, WithTransport(transportFunc(rt)), WithOutput(buf), WithReplyTimeout(timeout))
+	started := time.Now()
+	_, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate, LogicalResourceId: "Resource"}))
+	if err == nil || !strings.HasPrefix(err.Error(), "reply timed out after 20ms") {
+		t.Fatalf("got %v; want timeout", err)
+	}
+	if elapsed := time.Since(started); elapsed > 10*timeout {
+		t.Fatalf("got %v; want within %v", elapsed, 10*timeout)
+	}
+	if got, want := buf.String(), "[ERROR] Resource: reply timed out after 20ms"; !strings.Contains(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+func TestWithDryRun(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		buf   = &bytes.Buffer{}
+		calls int
+		rt    = func(req *http.Request) (*http.Response, error) {
+			t.Fatalf("got unexpected request to %v; want none", req.URL)
+			return nil, nil
+		}
+		fn = func(ctx context.Context, req *Request) (*Response, error) {
+			calls++
+			return &Response{PhysicalResourceId: "abc", Data: map[string]interface{}{"Password": "hunter2"}, NoEcho: true}, nil
+		}
+	)
+
+	handler := New(fn, WithTransport(transportFunc(rt)), WithOutput(buf), WithDryRun(true))
+	result, err := handler.Process(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate, LogicalResourceId: "Resource", ResponseURL: "https://example.com/reply"}))
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := calls, 1; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := result.Status, StatusSuccess; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if result.Delivered {
+		t.Fatalf("got true; want false")
+	}
+	if got, want := buf.String(), `Resource: dry run, reply not sent - status=SUCCESS physicalResourceId=abc reason=""`; !strings.Contains(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got := buf.String(); strings.Contains(got, "hunter2") {
+		t.Fatalf("got %v; want secret omitted", got)
+	}
+}
+
+func TestHandler_ReplyRejected(t *testing.T) {
+	var (
+		ctx = context.Background()
+		rt  = func(req *http.Request) (*http.Response, error) {
+			w := httptest.NewRecorder()
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>\n")
+			return w.Result(), nil
+		}
+		fn = func(ctx context.Context, req *Request) (*Response, error) {
+			return &Response{PhysicalResourceId: "abc"}, nil
+		}
+	)
+
+	handler := New(fn, WithTransport(transportFunc(rt)))
+	result, err := handler.Process(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate}))
+	if got, want := fmt.Sprint(err), "reply rejected with 403 Forbidden: <Error><Code>SignatureDoesNotMatch</Code></Error>"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if result.Delivered {
+		t.Fatalf("got true; want false")
+	}
+	if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err == nil {
+		t.Fatalf("got nil; want err")
+	}
+}
+
+func TestWithReplyContext(t *testing.T) {
+	var (
+		input ReplyInput
+		rt    = func(req *http.Request) (*http.Response, error) {
+			if err := req.Context().Err(); err != nil {
+				return nil, err
+			}
+			return captureReply(t, &input)(req)
+		}
+		replyContext = func(parent context.Context) (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), time.Second)
+		}
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the handler context is canceled while the Func runs e.g. during shutdown
+	fn := func(ctx context.Context, req *Request) (*Response, error) {
+		cancel()
+		return &Response{PhysicalResourceId: "abc"}, nil
+	}
+
+	handler := New(fn, WithTransport(transportFunc(rt)), WithReplyContext(replyContext))
+	if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := input.Status, StatusSuccess; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+func TestWithValidateResourceTypeFormat(t *testing.T) {
+	testCases := map[string]struct {
+		ResourceType string
+		Status       string
+	}{
+		"custom": {
+			ResourceType: "Custom::Foo",
+			Status:       StatusSuccess,
+		},
+		"built in": {
+			ResourceType: "AWS::CloudFormation::CustomResource",
+			Status:       StatusSuccess,
+		},
+		"invalid": {
+			ResourceType: "AWS::S3::Bucket",
+			Status:       StatusFailed,
+		},
+		"no name": {
+			ResourceType: "Custom::",
+			Status:       StatusFailed,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx   = context.Background()
+				input ReplyInput
+				fn    = func(ctx context.Context, req *Request) (*Response, error) {
+					return &Response{PhysicalResourceId: "abc"}, nil
+				}
+			)
+
+			handler := New(fn, WithTransport(captureReply(t, &input)), WithValidateResourceTypeFormat())
+			data := marshalRequest(t, Request{RequestType: RequestTypeCreate, ResourceType: tc.ResourceType})
+			if _, err := handler.Invoke(ctx, data); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Status, tc.Status; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestWithValidateRequestId(t *testing.T) {
+	testCases := map[string]struct {
+		RequestId string
+		Status    string
+	}{
+		"uuid": {
+			RequestId: "f5e3c5b0-6a2c-4b1f-9e8d-3c2b1a0f9e8d",
+			Status:    StatusSuccess,
+		},
+		"token": {
+			RequestId: "request-123",
+			Status:    StatusSuccess,
+		},
+		"empty": {
+			RequestId: "",
+			Status:    StatusFailed,
+		},
+		"whitespace": {
+			RequestId: "   ",
+			Status:    StatusFailed,
+		},
+		"embedded space": {
+			RequestId: "abc def",
+			Status:    StatusFailed,
+		},
+		"newline": {
+			RequestId: "abc\n",
+			Status:    StatusFailed,
+		},
+		"too long": {
+			RequestId: strings.Repeat("a", 300),
+			Status:    StatusFailed,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx   = context.Background()
+				input ReplyInput
+				fn    = func(ctx context.Context, req *Request) (*Response, error) {
+					return &Response{PhysicalResourceId: "abc"}, nil
+				}
+			)
+
+			handler := New(fn, WithTransport(captureReply(t, &input)), WithValidateRequestId())
+			data := marshalRequest(t, Request{RequestType: RequestTypeCreate, RequestId: tc.RequestId})
+			if _, err := handler.Invoke(ctx, data); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Status, tc.Status; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestWithPhysicalIDComparator(t *testing.T) {
+	var (
+		ignoreState = func(old, new string) bool {
+			oldID, _ := DecodeState(old, &struct{}{})
+			newID, _ := DecodeState(new, &struct{}{})
+			return oldID == newID
+		}
+		withState = func(id string, step int) string {
+			v, _ := EncodeState(id, map[string]int{"Step": step})
+			return v
+		}
+	)
+
+	testCases := map[string]struct {
+		Options     []Option
+		OldID       string
+		NewID       string
+		Replacement bool
+	}{
+		"default same": {
+			OldID: "abc",
+			NewID: "abc",
+		},
+		"default state changed": {
+			OldID:       withState("abc", 1),
+			NewID:       withState("abc", 2),
+			Replacement: true,
+		},
+		"comparator state changed": {
+			Options: []Option{WithPhysicalIDComparator(ignoreState)},
+			OldID:   withState("abc", 1),
+			NewID:   withState("abc", 2),
+		},
+		"comparator id changed": {
+			Options:     []Option{WithPhysicalIDComparator(ignoreState)},
+			OldID:       withState("abc", 1),
+			NewID:       withState("def", 1),
+			Replacement: true,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx   = context.Background()
+				buf   = bytes.NewBuffer(nil)
+				input ReplyInput
+				fn    = func(ctx context.Context, req *Request) (*Response, error) {
+					return &Response{PhysicalResourceId: tc.NewID}, nil
+				}
+			)
+
+			opts := append([]Option{WithTransport(captureReply(t, &input)), WithOutput(buf)}, tc.Options...)
+			handler := New(fn, opts...)
+			data := marshalRequest(t, Request{RequestType: RequestTypeUpdate, PhysicalResourceId: tc.OldID})
+			if _, err := handler.Invoke(ctx, data); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := strings.Contains(buf.String(), "replaces PhysicalResourceId"), tc.Replacement; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestWithMaxDataAttributes(t *testing.T) {
+	testCases := map[string]struct {
+		N      int
+		Status string
+		Reason string
+	}{
+		"under": {
+			N:      2,
+			Status: StatusSuccess,
+		},
+		"at": {
+			N:      3,
+			Status: StatusSuccess,
+		},
+		"over": {
+			N:      4,
+			Status: StatusFailed,
+			Reason: "handler returned 4 Data attributes; at most 3 are allowed",
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx   = context.Background()
+				input ReplyInput
+				fn    = func(ctx context.Context, req *Request) (*Response, error) {
+					data := map[string]interface{}{}
+					for i := 0; i < tc.N; i++ {
+						data[fmt.Sprintf("Key%v", i)] = "value"
+					}
+					return &Response{PhysicalResourceId: "abc", Data: data}, nil
+				}
+			)
+
+			handler := New(fn, WithTransport(captureReply(t, &input)), WithMaxDataAttributes(3))
+			if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Status, tc.Status; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := input.Reason, tc.Reason; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestWithMaxDataSize(t *testing.T) {
+	oversized := map[string]interface{}{}
+	for i := 0; i < 100; i++ {
+		oversized[fmt.Sprintf("Key%v", i)] = strings.Repeat("x", 64)
+	}
+
+	testCases := map[string]struct {
+		Opts   []Option
+		Data   map[string]interface{}
+		Status string
+		Reason string
+	}{
+		"small": {
+			Data:   map[string]interface{}{"Key": "value"},
+			Status: StatusSuccess,
+		},
+		"oversized": {
+			Data:   oversized,
+			Status: StatusFailed,
+			Reason: "handler returned 7491 bytes of Data; at most 4096 bytes are allowed",
+		},
+		"custom": {
+			Opts:   []Option{WithMaxDataSize(10)},
+			Data:   map[string]interface{}{"Key": "value"},
+			Status: StatusFailed,
+			Reason: "handler returned 15 bytes of Data; at most 10 bytes are allowed",
+		},
+		"disabled": {
+			Opts:   []Option{WithMaxDataSize(0)},
+			Data:   oversized,
+			Status: StatusSuccess,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx   = context.Background()
+				input ReplyInput
+				fn    = func(ctx context.Context, req *Request) (*Response, error) {
+					return &Response{PhysicalResourceId: "abc", Data: tc.Data}, nil
+				}
+			)
+
+			opts := append([]Option{WithTransport(captureReply(t, &input))}, tc.Opts...)
+			handler := New(fn, opts...)
+			if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Status, tc.Status; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := input.Reason, tc.Reason; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestResponseRawData(t *testing.T) {
+	const raw = `{"Nested":{"Z":1,"A":[true,"x"]},"Name":"widget"}`
+
+	testCases := map[string]struct {
+		Resp   Response
+		Status string
+		Body   string
+		Warn   bool
+	}{
+		"raw": {
+			Resp:   Response{PhysicalResourceId: "abc", RawData: json.RawMessage(raw)},
+			Status: StatusSuccess,
+			Body:   `"Data":` + raw,
+		},
+		"both": {
+			Resp:   Response{PhysicalResourceId: "abc", RawData: json.RawMessage(raw), Data: map[string]interface{}{"Name": "other"}},
+			Status: StatusSuccess,
+			Body:   `"Data":` + raw,
+			Warn:   true,
+		},
+		"not an object": {
+			Resp:   Response{PhysicalResourceId: "abc", RawData: json.RawMessage(`[1,2]`)},
+			Status: StatusFailed,
+			Body:   `"Reason":"handler returned RawData that is not a json object"`,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx  = context.Background()
+				buf  = &bytes.Buffer{}
+				body []byte
+				resp = tc.Resp
+				fn   = func(ctx context.Context, req *Request) (*Response, error) {
+					return &resp, nil
+				}
+				rt = func(req *http.Request) (*http.Response, error) {
+					body, _ = ioutil.ReadAll(req.Body)
+					w := httptest.NewRecorder()
+					w.WriteHeader(http.StatusOK)
+					return w.Result(), nil
+				}
+			)
+
+			handler := New(fn, WithTransport(transportFunc(rt)), WithOutput(buf))
+			result, err := handler.Process(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate, LogicalResourceId: "Resource"}))
+			if err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := result.Status, tc.Status; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := string(body), tc.Body; !strings.Contains(got, want) {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := strings.Contains(buf.String(), "[WARN] Resource: Create returned both Data and RawData; using RawData"), tc.Warn; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestInvalidRequestType(t *testing.T) {
+	testCases := map[string]struct {
+		RequestType string
+		Reason      string
+	}{
+		"empty": {
+			RequestType: "",
+			Reason:      `invalid RequestType, ""; expected one of Create, Update, Delete`,
+		},
+		"garbage": {
+			RequestType: "Upsert",
+			Reason:      `invalid RequestType, "Upsert"; expected one of Create, Update, Delete`,
+		},
+		"case": {
+			RequestType: "create",
+			Reason:      `invalid RequestType, "create"; expected one of Create, Update, Delete`,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx    = context.Background()
+				input  ReplyInput
+				called bool
+				fn     = func(ctx context.Context, req *Request) (*Response, error) {
+					called = true
+					return &Response{PhysicalResourceId: "abc"}, nil
+				}
+				handler = New(fn, WithTransport(captureReply(t, &input)))
+			)
+
+			if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: tc.RequestType})); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if called {
+				t.Fatalf("got true; want false")
+			}
+			if got, want := input.Status, StatusFailed; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := input.Reason, tc.Reason; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		for _, requestType := range RequestTypes {
+			if !IsValidRequestType(requestType) {
+				t.Fatalf("got false; want true for %v", requestType)
+			}
+		}
+	})
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	var (
+		ctx = context.Background()
+		fn  = func(ctx context.Context, req *Request) (*Response, error) {
+			return &Response{PhysicalResourceId: "abc"}, nil
+		}
+		hang = transportFunc(func(req *http.Request) (*http.Response, error) {
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		})
+	)
+
+	t.Run("timeout", func(t *testing.T) {
+		client := &http.Client{Transport: hang, Timeout: 10 * time.Millisecond}
+		handler := New(fn, WithHTTPClient(client))
+
+		_, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate}))
+		if err == nil {
+			t.Fatalf("got nil; want err")
+		}
+		var timeout interface{ Timeout() bool }
+		if !errors.As(err, &timeout) || !timeout.Timeout() {
+			t.Fatalf("got %v; want timeout", err)
+		}
+	})
+
+	t.Run("last wins", func(t *testing.T) {
+		var (
+			input   ReplyInput
+			client  = &http.Client{Transport: hang, Timeout: 10 * time.Millisecond}
+			handler = New(fn, WithHTTPClient(client), WithTransport(captureReply(t, &input)))
+		)
+
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := input.Status, StatusSuccess; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+}
+
+func TestResponseReason(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		input ReplyInput
+		fn    = func(ctx context.Context, req *Request) (*Response, error) {
+			return &Response{PhysicalResourceId: "abc", Reason: "reused existing bucket"}, nil
+		}
+	)
+
+	handler := New(fn, WithTransport(captureReply(t, &input)))
+	if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := input.Status, StatusSuccess; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := input.Reason, "reused existing bucket"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	t.Run("oversized", func(t *testing.T) {
+		var (
+			input  ReplyInput
+			reason = "reused\nexisting bucket " + strings.Repeat("x", 10000)
+			fn     = func(ctx context.Context, req *Request) (*Response, error) {
+				return &Response{PhysicalResourceId: "abc", Reason: reason}, nil
+			}
+		)
+
+		handler := New(fn, WithTransport(captureReply(t, &input)))
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := input.Status, StatusSuccess; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := len(input.Reason), maxReasonLength; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if want := "reused existing bucket x"; !strings.HasPrefix(input.Reason, want) {
+			t.Fatalf("got %v; want prefix %v", input.Reason, want)
+		}
+	})
+}
+
+func TestResponseNoEcho(t *testing.T) {
+	for _, noEcho := range []bool{true, false} {
+		var (
+			ctx  = context.Background()
+			body map[string]interface{}
+			fn   = func(ctx context.Context, req *Request) (*Response, error) {
+				return &Response{
+					PhysicalResourceId: "abc",
+					Data:               map[string]interface{}{"Password": "hunter2"},
+					NoEcho:             noEcho,
+				}, nil
+			}
+			rt = func(req *http.Request) (*http.Response, error) {
+				if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+					t.Fatalf("got %v; want nil", err)
+				}
+				w := httptest.NewRecorder()
+				w.WriteHeader(http.StatusOK)
+				return w.Result(), nil
+			}
+		)
+
+		handler := New(fn, WithTransport(transportFunc(rt)))
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := body["NoEcho"], noEcho; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	}
+}
+
+func TestWithRecoverRetry(t *testing.T) {
+	t.Run("panic once", func(t *testing.T) {
+		var (
+			ctx    = context.Background()
+			input  ReplyInput
+			calls  int
+			resets int
+			cache  map[string]string
+			fn     = func(ctx context.Context, req *Request) (*Response, error) {
+				calls++
+				cache["key"] = "value" // panics until the cache is reset
+				return &Response{PhysicalResourceId: "abc"}, nil
+			}
+			reset = func() {
+				resets++
+				cache = map[string]string{}
+			}
+		)
+
+		handler := New(fn, WithTransport(captureReply(t, &input)), WithRecoverRetry(reset))
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := calls, 2; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := resets, 1; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := input.Status, StatusSuccess; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("panic twice", func(t *testing.T) {
+		var (
+			ctx   = context.Background()
+			input ReplyInput
+			calls int
+			fn    = func(ctx context.Context, req *Request) (*Response, error) {
+				calls++
+				panic("boom")
+			}
+		)
+
+		handler := New(fn, WithTransport(captureReply(t, &input)), WithRecoverRetry())
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := calls, 2; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := input.Status, StatusFailed; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+}
+
+func TestWithPostReplyGrace(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		input ReplyInput
+		done  = make(chan struct{})
+		fn    = func(ctx context.Context, req *Request) (*Response, error) {
+			go func() {
+				time.Sleep(10 * time.Millisecond) // background work e.g. a metrics flush
+				close(done)
+			}()
+			return &Response{PhysicalResourceId: "abc"}, nil
+		}
+	)
+
+	handler := New(fn, WithTransport(captureReply(t, &input)), WithPostReplyGrace(time.Second/2))
+	if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	select {
+	case <-done:
+	default:
+		t.Fatalf("got incomplete; want background work complete")
+	}
+}
+
+func TestHandler_Process(t *testing.T) {
+	var (
+		ctx = context.Background()
+		fn  = func(ctx context.Context, req *Request) (*Response, error) {
+			if req.RequestType == RequestTypeDelete {
+				return nil, errors.New("boom")
+			}
+			return &Response{
+				PhysicalResourceId: "abc",
+				Data:               map[string]interface{}{"Arn": "arn:test"},
+			}, nil
+		}
+		handler = New(fn, WithTransport(okTransport{}))
+	)
+
+	result, err := handler.Process(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate}))
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	want := &Result{
+		Status:             StatusSuccess,
+		PhysicalResourceId: "abc",
+		Data:               map[string]interface{}{"Arn": "arn:test"},
+		Delivered:          true,
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Fatalf("got %#v; want %#v", result, want)
+	}
+
+	result, err = handler.Process(ctx, marshalRequest(t, Request{RequestType: RequestTypeDelete, PhysicalResourceId: "abc"}))
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	want = &Result{
+		Status:             StatusFailed,
+		PhysicalResourceId: "abc",
+		Reason:             "boom",
+		Delivered:          true,
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Fatalf("got %#v; want %#v", result, want)
+	}
+
+	if _, err := handler.Process(ctx, []byte("{")); err == nil {
+		t.Fatalf("got nil; want error")
+	}
+}
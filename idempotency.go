@@ -0,0 +1,104 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"sync"
+)
+
+// IdempotencyStore records the replies already sent so a request retried by
+// CloudFormation does not invoke the Func a second time.  The store must be
+// shared across Lambda containers; production users typically supply one
+// backed by DynamoDB with a TTL on each record.
+type IdempotencyStore interface {
+	// Load returns the reply previously sent for requestId or nil if none
+	// has been recorded
+	Load(requestId string) (*ReplyInput, error)
+	// Store records the reply sent for requestId
+	Store(requestId string, reply *ReplyInput) error
+}
+
+// MemoryIdempotencyStore keeps replies in memory, keyed by RequestId
+type MemoryIdempotencyStore struct {
+	mutex   sync.Mutex
+	replies map[string]ReplyInput
+}
+
+// NewMemoryIdempotencyStore returns a new MemoryIdempotencyStore
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		replies: map[string]ReplyInput{},
+	}
+}
+
+// Load implements IdempotencyStore
+func (m *MemoryIdempotencyStore) Load(requestId string) (*ReplyInput, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	reply, ok := m.replies[requestId]
+	if !ok {
+		return nil, nil
+	}
+	return &reply, nil
+}
+
+// Store implements IdempotencyStore
+func (m *MemoryIdempotencyStore) Store(requestId string, reply *ReplyInput) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.replies[requestId] = *reply
+	return nil
+}
+
+// replayResponder sends a reply, previously sent for the same RequestId,
+// again.  The reply was checked when first sent so it is not checked again.
+type replayResponder struct {
+	reply *ReplyInput
+}
+
+// BuildReply implements Responder
+func (r replayResponder) BuildReply(req *Request) (*ReplyInput, error) {
+	return r.reply, nil
+}
+
+// replay returns a Response that sends reply again
+func replay(reply *ReplyInput) *Response {
+	return Respond(replayResponder{reply: reply})
+}
+
+// recordReply stores a SUCCESS reply once the ResponseURL has accepted it so
+// a retry of the request replays it.  Replies that were not delivered are not
+// recorded; a retry calls the Func again.
+func (h *Handler) recordReply(req *Request, input *ReplyInput) {
+	if input.Status != StatusSuccess {
+		return
+	}
+	if err := h.idempotency.Store(req.RequestId, input); err != nil {
+		h.logf(LogWarn, req, "%v: unable to record RequestId %v - %v\n", req.LogicalResourceId, req.RequestId, err)
+	}
+}
+
+// WithIdempotency skips the Func for requests whose RequestId store has
+// already seen and sends the reply recorded for it again, PhysicalResourceId
+// and Data included.  A SUCCESS reply is recorded only once the ResponseURL
+// accepts it.  Combine with WithDistributedLock to serialize concurrent
+// retries.
+func WithIdempotency(store IdempotencyStore) Option {
+	return func(o *options) {
+		o.idempotency = store
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+type failingIdempotencyStore struct{}
+
+func (failingIdempotencyStore) Load(string) (*ReplyInput, error) { return nil, errors.New("throttled") }
+func (failingIdempotencyStore) Store(string, *ReplyInput) error  { return nil }
+
+func TestWithIdempotency(t *testing.T) {
+	t.Run("retry", func(t *testing.T) {
+		var (
+			ctx   = context.Background()
+			input ReplyInput
+			calls int
+			store = NewMemoryIdempotencyStore()
+			fn    = func(ctx context.Context, req *Request) (*Response, error) {
+				calls++
+				return &Response{PhysicalResourceId: "existing"}, nil
+			}
+			req = Request{
+				RequestType:        RequestTypeUpdate,
+				RequestId:          "request-id",
+				LogicalResourceId:  "Resource",
+				PhysicalResourceId: "existing",
+			}
+		)
+
+		handler := New(fn, WithTransport(captureReply(t, &input)), WithIdempotency(store))
+		for i := 0; i < 2; i++ {
+			if _, err := handler.Invoke(ctx, marshalRequest(t, req)); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Status, StatusSuccess; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := input.PhysicalResourceId, "existing"; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		}
+		if got, want := calls, 1; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+
+		req.RequestId = "other-id"
+		if _, err := handler.Invoke(ctx, marshalRequest(t, req)); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := calls, 2; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("failure not recorded", func(t *testing.T) {
+		var (
+			ctx   = context.Background()
+			input ReplyInput
+			calls int
+			store = NewMemoryIdempotencyStore()
+			fn    = func(ctx context.Context, req *Request) (*Response, error) {
+				calls++
+				return nil, errors.New("boom")
+			}
+		)
+
+		handler := New(fn, WithTransport(captureReply(t, &input)), WithIdempotency(store))
+		for i := 0; i < 2; i++ {
+			if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate, RequestId: "request-id"})); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+		}
+		if got, want := calls, 2; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("replays prior reply", func(t *testing.T) {
+		var (
+			ctx   = context.Background()
+			input ReplyInput
+			calls int
+			store = NewMemoryIdempotencyStore()
+			fn    = func(ctx context.Context, req *Request) (*Response, error) {
+				calls++
+				return &Response{
+					PhysicalResourceId: fmt.Sprintf("i-%v", calls),
+					Data:               map[string]interface{}{"Arn": fmt.Sprintf("arn-%v", calls)},
+				}, nil
+			}
+			req = Request{RequestType: RequestTypeCreate, RequestId: "request-id", LogicalResourceId: "Resource"}
+		)
+
+		handler := New(fn, WithTransport(captureReply(t, &input)), WithIdempotency(store))
+		for i := 0; i < 2; i++ {
+			input = ReplyInput{}
+			if _, err := handler.Invoke(ctx, marshalRequest(t, req)); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.PhysicalResourceId, "i-1"; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := input.Data, map[string]interface{}{"Arn": "arn-1"}; !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		}
+		if got, want := calls, 1; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("undelivered not recorded", func(t *testing.T) {
+		var (
+			ctx       = context.Background()
+			calls     int
+			store     = NewMemoryIdempotencyStore()
+			transport = transportFunc(func(req *http.Request) (*http.Response, error) {
+				return nil, errors.New("connection reset")
+			})
+			fn = func(ctx context.Context, req *Request) (*Response, error) {
+				calls++
+				return &Response{PhysicalResourceId: "abc"}, nil
+			}
+		)
+
+		handler := New(fn, WithTransport(transport), WithIdempotency(store))
+		for i := 0; i < 2; i++ {
+			if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate, RequestId: "request-id"})); err == nil {
+				t.Fatalf("got nil; want err")
+			}
+		}
+		if got, want := calls, 2; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("invalid response not recorded", func(t *testing.T) {
+		var (
+			ctx   = context.Background()
+			input ReplyInput
+			calls int
+			store = NewMemoryIdempotencyStore()
+			fn    = func(ctx context.Context, req *Request) (*Response, error) {
+				calls++
+				return &Response{PhysicalResourceId: "abc", Data: map[string]interface{}{"a": "1", "b": "2"}}, nil
+			}
+		)
+
+		handler := New(fn, WithTransport(captureReply(t, &input)), WithIdempotency(store), WithMaxDataAttributes(1))
+		for i := 0; i < 2; i++ {
+			if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate, RequestId: "request-id"})); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Status, StatusFailed; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		}
+		if got, want := calls, 2; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("store error", func(t *testing.T) {
+		var (
+			ctx   = context.Background()
+			input ReplyInput
+			fn    = func(ctx context.Context, req *Request) (*Response, error) {
+				return &Response{PhysicalResourceId: "abc"}, nil
+			}
+		)
+
+		handler := New(fn, WithTransport(captureReply(t, &input)), WithIdempotency(failingIdempotencyStore{}))
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate, RequestId: "request-id"})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := input.Reason, "unable to check whether RequestId request-id was processed: throttled"; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+}
@@ -0,0 +1,291 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonSchema implements the commonly used subset of JSON Schema: type,
+// properties, required, additionalProperties (boolean), items, enum,
+// minLength, maxLength, pattern, minimum, and maximum.  Other keywords are
+// ignored.
+type jsonSchema struct {
+	Type                 typeList               `json:"type"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	Enum                 []interface{}          `json:"enum"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	Pattern              string                 `json:"pattern"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+
+	re *regexp.Regexp
+}
+
+// typeList holds the type keyword which may be either a string or an array
+type typeList []string
+
+func (t *typeList) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*t = typeList{s}
+		return nil
+	}
+
+	var ss []string
+	if err := json.Unmarshal(data, &ss); err != nil {
+		return fmt.Errorf("type must be a string or an array of strings")
+	}
+	*t = ss
+	return nil
+}
+
+// compileSchema parses a json schema document
+func compileSchema(data []byte) (*jsonSchema, error) {
+	var s jsonSchema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("unable to parse schema: %v", err)
+	}
+	if err := s.compile(""); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// compile prepares s for validation; path names s within the schema
+func (s *jsonSchema) compile(path string) error {
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("unable to compile pattern, %v: %v", s.Pattern, err)
+		}
+		s.re = re
+	}
+	keys := make([]string, 0, len(s.Properties))
+	for key := range s.Properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		childPath := key
+		if path != "" {
+			childPath = path + "." + key
+		}
+		child := s.Properties[key]
+		if child == nil {
+			return fmt.Errorf("invalid schema for property, %v: must be an object", childPath)
+		}
+		if err := child.compile(childPath); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile(path + "[]")
+	}
+	return nil
+}
+
+// typeOf returns the json schema type of a value decoded by encoding/json
+func typeOf(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func (s *jsonSchema) matchesType(v interface{}) bool {
+	if len(s.Type) == 0 {
+		return true
+	}
+	actual := typeOf(v)
+	for _, want := range s.Type {
+		if want == actual || (want == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// validate returns one FieldError per violation found in v, a value decoded
+// by encoding/json
+func (s *jsonSchema) validate(path string, v interface{}) []FieldError {
+	if !s.matchesType(v) {
+		return []FieldError{{Path: path, Message: fmt.Sprintf("must be of type %v", strings.Join(s.Type, " or "))}}
+	}
+
+	var fields []FieldError
+	if len(s.Enum) > 0 {
+		var found bool
+		for _, e := range s.Enum {
+			if fmt.Sprint(e) == fmt.Sprint(v) && typeOf(e) == typeOf(v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fields = append(fields, FieldError{Path: path, Message: fmt.Sprintf("must be one of %v", s.Enum)})
+		}
+	}
+
+	switch v := v.(type) {
+	case string:
+		if n := len([]rune(v)); s.MinLength != nil && n < *s.MinLength {
+			fields = append(fields, FieldError{Path: path, Message: fmt.Sprintf("must be at least %v characters", *s.MinLength)})
+		} else if s.MaxLength != nil && n > *s.MaxLength {
+			fields = append(fields, FieldError{Path: path, Message: fmt.Sprintf("must be at most %v characters", *s.MaxLength)})
+		}
+		if s.re != nil && !s.re.MatchString(v) {
+			fields = append(fields, FieldError{Path: path, Message: fmt.Sprintf("must match pattern %v", s.Pattern)})
+		}
+
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			fields = append(fields, FieldError{Path: path, Message: fmt.Sprintf("must be at least %v", *s.Minimum)})
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			fields = append(fields, FieldError{Path: path, Message: fmt.Sprintf("must be at most %v", *s.Maximum)})
+		}
+
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				fields = append(fields, s.Items.validate(fmt.Sprintf("%v[%v]", path, i), item)...)
+			}
+		}
+
+	case map[string]interface{}:
+		for _, key := range s.Required {
+			if _, ok := v[key]; !ok {
+				fields = append(fields, FieldError{Path: path + "." + key, Message: "is required"})
+			}
+		}
+
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			child, ok := s.Properties[key]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					fields = append(fields, FieldError{Path: path + "." + key, Message: "is not allowed"})
+				}
+				continue
+			}
+			fields = append(fields, child.validate(path+"."+key, v[key])...)
+		}
+	}
+
+	return fields
+}
+
+// coerce returns a copy of v, a value decoded by encoding/json, with each
+// string scalar converted to the boolean or number the schema expects for it.
+// CloudFormation sends every scalar property as a string e.g. "8080" and
+// "true", so a schema for ResourceProperties could not otherwise use the
+// integer, number, or boolean types.  Strings that do not parse, or whose
+// schema also allows string, are left as is.
+func (s *jsonSchema) coerce(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		if s.allows("string") {
+			return v
+		}
+		if s.allows("boolean") && (v == "true" || v == "false") {
+			return v == "true"
+		}
+		if s.allows("integer") || s.allows("number") {
+			if f, err := strconv.ParseFloat(v, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+				return f
+			}
+		}
+		return v
+
+	case []interface{}:
+		if s.Items == nil {
+			return v
+		}
+		coerced := make([]interface{}, len(v))
+		for i, item := range v {
+			coerced[i] = s.Items.coerce(item)
+		}
+		return coerced
+
+	case map[string]interface{}:
+		coerced := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			if child, ok := s.Properties[key]; ok {
+				value = child.coerce(value)
+			}
+			coerced[key] = value
+		}
+		return coerced
+
+	default:
+		return v
+	}
+}
+
+// allows returns true if the type keyword lists typ
+func (s *jsonSchema) allows(typ string) bool {
+	for _, t := range s.Type {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// validateJSON validates v, after round tripping it through encoding/json
+func (s *jsonSchema) validateJSON(path string, v interface{}) ([]FieldError, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+
+	return s.validate(path, decoded), nil
+}
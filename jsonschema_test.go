@@ -0,0 +1,99 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestJSONSchema(t *testing.T) {
+	const schema = `{
+		"type": "object",
+		"required": ["Name"],
+		"additionalProperties": false,
+		"properties": {
+			"Name":  {"type": "string", "minLength": 3, "maxLength": 8},
+			"Tier":  {"enum": ["free", "paid"]},
+			"Ports": {"type": "array", "items": {"type": "integer", "maximum": 65535}},
+			"Ratio": {"type": ["number", "null"]}
+		}
+	}`
+
+	s, err := compileSchema([]byte(schema))
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	testCases := map[string]struct {
+		Value interface{}
+		Want  []string
+	}{
+		"valid": {
+			Value: map[string]interface{}{"Name": "blah", "Tier": "free", "Ports": []int{80, 443}, "Ratio": 0.5},
+		},
+		"null allowed": {
+			Value: map[string]interface{}{"Name": "blah", "Ratio": nil},
+		},
+		"violations": {
+			Value: map[string]interface{}{"Name": "ab", "Tier": "gold", "Ports": []interface{}{80, "443", 70000}, "Extra": true},
+			Want: []string{
+				"$.Extra: is not allowed",
+				"$.Name: must be at least 3 characters",
+				"$.Ports[1]: must be of type integer",
+				"$.Ports[2]: must be at most 65535",
+				"$.Tier: must be one of [free paid]",
+			},
+		},
+		"missing required": {
+			Value: map[string]interface{}{},
+			Want:  []string{"$.Name: is required"},
+		},
+		"wrong type": {
+			Value: "blah",
+			Want:  []string{"$: must be of type object"},
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			fields, err := s.validateJSON("$", tc.Value)
+			if err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			var got []string
+			for _, f := range fields {
+				got = append(got, f.String())
+			}
+			if want := tc.Want; !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+
+	if _, err := compileSchema([]byte(`{"pattern": "("}`)); err == nil {
+		t.Fatalf("got nil; want err")
+	}
+
+	for schema, want := range map[string]string{
+		`{"properties":{"a":null}}`:                      "invalid schema for property, a: must be an object",
+		`{"properties":{"a":{"properties":{"b":null}}}}`: "invalid schema for property, a.b: must be an object",
+		`{"items":{"properties":{"a":null}}}`:            "invalid schema for property, [].a: must be an object",
+	} {
+		if _, err := compileSchema([]byte(schema)); err == nil || err.Error() != want {
+			t.Fatalf("got %v; want %v", err, want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Locker provides mutual exclusion across invocations, typically backed by a
+// shared store such as DynamoDB
+type Locker interface {
+	// Acquire blocks until the lock for key is held or ctx is done
+	Acquire(ctx context.Context, key string) error
+	// Release releases the lock for key
+	Release(key string) error
+}
+
+// MemoryLocker serializes invocations within a single process
+type MemoryLocker struct {
+	mutex sync.Mutex
+	locks map[string]chan struct{}
+}
+
+// NewMemoryLocker returns a new MemoryLocker
+func NewMemoryLocker() *MemoryLocker {
+	return &MemoryLocker{
+		locks: map[string]chan struct{}{},
+	}
+}
+
+func (m *MemoryLocker) lock(key string) chan struct{} {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	ch, ok := m.locks[key]
+	if !ok {
+		ch = make(chan struct{}, 1)
+		m.locks[key] = ch
+	}
+	return ch
+}
+
+// Acquire implements Locker
+func (m *MemoryLocker) Acquire(ctx context.Context, key string) error {
+	select {
+	case m.lock(key) <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release implements Locker
+func (m *MemoryLocker) Release(key string) error {
+	select {
+	case <-m.lock(key):
+		return nil
+	default:
+		return fmt.Errorf("lock %v not held", key)
+	}
+}
+
+type distributedLock struct {
+	locker Locker
+	keyFn  func(*Request) string
+}
+
+// acquireLock acquires the lock for the request and returns a func that
+// releases it
+func (h *Handler) acquireLock(ctx context.Context, req *Request) (func(), error) {
+	key := h.distributedLock.keyFn(req)
+	if err := h.distributedLock.locker.Acquire(ctx, key); err != nil {
+		return nil, fmt.Errorf("unable to acquire lock %v: %v", key, err)
+	}
+
+	release := func() {
+		if err := h.distributedLock.locker.Release(key); err != nil {
+			h.logf(LogWarn, req, "%v: unable to release lock %v - %v\n", req.LogicalResourceId, key, err)
+		}
+	}
+	return release, nil
+}
+
+// WithDistributedLock serializes calls to the Func for requests that share
+// the key returned by keyFn.  If the lock cannot be acquired before the
+// invocation context is done, the Handler replies FAILED.
+func WithDistributedLock(locker Locker, keyFn func(*Request) string) Option {
+	return func(o *options) {
+		if locker != nil && keyFn != nil {
+			o.distributedLock = &distributedLock{
+				locker: locker,
+				keyFn:  keyFn,
+			}
+		}
+	}
+}
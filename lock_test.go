@@ -0,0 +1,114 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWithDistributedLock(t *testing.T) {
+	keyFn := func(req *Request) string { return req.ResourceType }
+
+	t.Run("serialized", func(t *testing.T) {
+		var (
+			ctx     = context.Background()
+			locker  = NewMemoryLocker()
+			mutex   sync.Mutex
+			running int
+			peak    int
+			fn      = func(ctx context.Context, req *Request) (*Response, error) {
+				mutex.Lock()
+				running++
+				if running > peak {
+					peak = running
+				}
+				mutex.Unlock()
+
+				time.Sleep(10 * time.Millisecond)
+
+				mutex.Lock()
+				running--
+				mutex.Unlock()
+				return &Response{PhysicalResourceId: "abc"}, nil
+			}
+			handler = New(fn, WithTransport(okTransport{}), WithDistributedLock(locker, keyFn))
+			data    = marshalRequest(t, Request{RequestType: RequestTypeCreate, ResourceType: "Custom::Shared"})
+			wg      sync.WaitGroup
+		)
+
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				handler.Invoke(ctx, data)
+			}()
+		}
+		wg.Wait()
+
+		if got, want := peak, 1; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("contention", func(t *testing.T) {
+		var (
+			input  ReplyInput
+			locker = NewMemoryLocker()
+			called bool
+			fn     = func(ctx context.Context, req *Request) (*Response, error) {
+				called = true
+				return &Response{PhysicalResourceId: "abc"}, nil
+			}
+		)
+		if err := locker.Acquire(context.Background(), "Custom::Shared"); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		defer locker.Release("Custom::Shared")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		time.AfterFunc(20*time.Millisecond, cancel)
+
+		handler := New(fn,
+			WithTransport(captureReply(t, &input)),
+			WithDistributedLock(locker, keyFn),
+			WithReplyContext(func(parent context.Context) (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), time.Second)
+			}),
+		)
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate, ResourceType: "Custom::Shared"})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if called {
+			t.Fatalf("got true; want false")
+		}
+		if got, want := input.Status, StatusFailed; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if !strings.HasPrefix(input.Reason, "unable to acquire lock Custom::Shared") {
+			t.Fatalf("got %v; want lock reason", input.Reason)
+		}
+	})
+
+	t.Run("release unheld", func(t *testing.T) {
+		if err := NewMemoryLocker().Release("key"); err == nil {
+			t.Fatalf("got nil; want error")
+		}
+	})
+}
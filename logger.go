@@ -0,0 +1,74 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"fmt"
+	"io"
+)
+
+// maxLoggedBody limits how much of the ResponseURL response body is logged
+const maxLoggedBody = 4096
+
+// maxErrorBody limits how much of a rejected reply's response body is
+// included in the error
+const maxErrorBody = 512
+
+// Logger receives the events logged by the Handler.  msg is a human readable
+// description of the event; kv holds alternating keys and values that
+// identify the request, logicalResourceId, requestType, and requestId, when
+// the event relates to one.
+type Logger interface {
+	Debug(msg string, kv ...interface{})
+	Info(msg string, kv ...interface{})
+	Warn(msg string, kv ...interface{})
+	Error(msg string, kv ...interface{})
+}
+
+// textLogger writes events as lines of text prefixed with their level e.g.
+//
+//	[INFO] MyResource: Create succeeded. PhysicalResourceId=abc
+//
+// kv is not written as msg already names the resource.
+type textLogger struct {
+	output      io.Writer
+	errorOutput io.Writer
+}
+
+// writer returns the output for events at level
+func (t *textLogger) writer(level LogLevel) io.Writer {
+	if level >= LogError {
+		return t.errorOutput
+	}
+	return t.output
+}
+
+func (t *textLogger) write(level LogLevel, msg string) {
+	fmt.Fprintf(t.writer(level), "[%v] %v\n", level, msg)
+}
+
+func (t *textLogger) Debug(msg string, kv ...interface{}) { t.write(LogDebug, msg) }
+func (t *textLogger) Info(msg string, kv ...interface{})  { t.write(LogInfo, msg) }
+func (t *textLogger) Warn(msg string, kv ...interface{})  { t.write(LogWarn, msg) }
+func (t *textLogger) Error(msg string, kv ...interface{}) { t.write(LogError, msg) }
+
+// WithLogger sends the events logged by the Handler to logger, e.g. to emit
+// structured json for CloudWatch Logs Insights, in place of the text written
+// to WithOutput and WithErrorOutput.  WithLogLevel still applies.
+func WithLogger(logger Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type logEntry struct {
+	Level LogLevel
+	Msg   string
+	KV    []interface{}
+}
+
+// recordingLogger records the events it receives
+type recordingLogger struct {
+	mutex   sync.Mutex
+	entries []logEntry
+}
+
+func (r *recordingLogger) record(level LogLevel, msg string, kv []interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.entries = append(r.entries, logEntry{Level: level, Msg: msg, KV: kv})
+}
+
+func (r *recordingLogger) Debug(msg string, kv ...interface{}) { r.record(LogDebug, msg, kv) }
+func (r *recordingLogger) Info(msg string, kv ...interface{})  { r.record(LogInfo, msg, kv) }
+func (r *recordingLogger) Warn(msg string, kv ...interface{})  { r.record(LogWarn, msg, kv) }
+func (r *recordingLogger) Error(msg string, kv ...interface{}) { r.record(LogError, msg, kv) }
+
+func (r *recordingLogger) find(msg string) (logEntry, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, e := range r.entries {
+		if e.Msg == msg {
+			return e, true
+		}
+	}
+	return logEntry{}, false
+}
+
+func TestWithLogger(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		input  ReplyInput
+		logger = &recordingLogger{}
+		fn     = func(ctx context.Context, req *Request) (*Response, error) {
+			if req.RequestType == RequestTypeDelete {
+				return nil, errors.New("boom")
+			}
+			return &Response{PhysicalResourceId: "abc"}, nil
+		}
+	)
+
+	handler := New(fn, WithTransport(captureReply(t, &input)), WithLogger(logger))
+	for _, requestType := range []string{RequestTypeCreate, RequestTypeDelete} {
+		data := marshalRequest(t, Request{RequestType: requestType, LogicalResourceId: "Resource", RequestId: "request-id"})
+		if _, err := handler.Invoke(ctx, data); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+	}
+
+	testCases := map[string]struct {
+		Msg   string
+		Level LogLevel
+		KV    []interface{}
+	}{
+		"success": {
+			Msg:   "Resource: Create succeeded. PhysicalResourceId=abc",
+			Level: LogInfo,
+			KV:    []interface{}{"logicalResourceId", "Resource", "requestType", RequestTypeCreate, "requestId", "request-id"},
+		},
+		"failure": {
+			Msg:   "Resource: Delete failed - boom",
+			Level: LogError,
+			KV:    []interface{}{"logicalResourceId", "Resource", "requestType", RequestTypeDelete, "requestId", "request-id"},
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			got, ok := logger.find(tc.Msg)
+			if !ok {
+				t.Fatalf("got %v; want %v", logger.entries, tc.Msg)
+			}
+			if got.Level != tc.Level {
+				t.Fatalf("got %v; want %v", got.Level, tc.Level)
+			}
+			if !reflect.DeepEqual(got.KV, tc.KV) {
+				t.Fatalf("got %v; want %v", got.KV, tc.KV)
+			}
+		})
+	}
+
+	if _, ok := logger.find("Resource: Create received. RequestId=request-id"); ok {
+		t.Fatalf("got debug event; want suppressed by default level")
+	}
+}
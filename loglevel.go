@@ -0,0 +1,56 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import "fmt"
+
+// LogLevel orders the severity of events written to the output
+type LogLevel int
+
+const (
+	// LogDebug events provide detail e.g. each request received
+	LogDebug LogLevel = iota
+	// LogInfo events record normal operation e.g. successful replies
+	LogInfo
+	// LogWarn events record recoverable problems e.g. retries
+	LogWarn
+	// LogError events record failures e.g. FAILED replies and panics
+	LogError
+)
+
+// String implements fmt.Stringer
+func (l LogLevel) String() string {
+	switch l {
+	case LogDebug:
+		return "DEBUG"
+	case LogInfo:
+		return "INFO"
+	case LogWarn:
+		return "WARN"
+	case LogError:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("LogLevel(%d)", int(l))
+	}
+}
+
+// WithLogLevel suppresses events below level.  Each line written to the
+// output is prefixed with its level e.g. [INFO] so CloudWatch Logs filters
+// can match on it.  Defaults to LogInfo.
+func WithLogLevel(level LogLevel) Option {
+	return func(o *options) {
+		o.logLevel = level
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWithLogLevel(t *testing.T) {
+	testCases := map[string]struct {
+		Level   LogLevel
+		Err     error
+		Want    []string
+		WantNot []string
+	}{
+		"default success": {
+			Level:   LogInfo,
+			Want:    []string{"[INFO] Resource: Create succeeded"},
+			WantNot: []string{"[DEBUG]"},
+		},
+		"debug success": {
+			Level: LogDebug,
+			Want:  []string{"[DEBUG] Resource: Create received", "[INFO] Resource: Create succeeded"},
+		},
+		"error success": {
+			Level:   LogError,
+			WantNot: []string{"[DEBUG]", "[INFO]"},
+		},
+		"error failure": {
+			Level:   LogError,
+			Err:     errors.New("boom"),
+			Want:    []string{"[ERROR] Resource: Create failed - boom"},
+			WantNot: []string{"[DEBUG]", "[INFO]"},
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx   = context.Background()
+				buf   = bytes.NewBuffer(nil)
+				input ReplyInput
+				fn    = func(ctx context.Context, req *Request) (*Response, error) {
+					if tc.Err != nil {
+						return nil, tc.Err
+					}
+					return &Response{PhysicalResourceId: "abc"}, nil
+				}
+			)
+
+			handler := New(fn, WithTransport(captureReply(t, &input)), WithOutput(buf), WithLogLevel(tc.Level))
+			data := marshalRequest(t, Request{RequestType: RequestTypeCreate, LogicalResourceId: "Resource"})
+			if _, err := handler.Invoke(ctx, data); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+
+			output := buf.String()
+			for _, want := range tc.Want {
+				if !strings.Contains(output, want) {
+					t.Fatalf("got %v; want %v", output, want)
+				}
+			}
+			for _, want := range tc.WantNot {
+				if strings.Contains(output, want) {
+					t.Fatalf("got %v; want no %v", output, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLogLevel_String(t *testing.T) {
+	if got, want := LogWarn.String(), "WARN"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := LogLevel(42).String(), "LogLevel(42)"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+func TestWithErrorOutput(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		input  ReplyInput
+		stdout = bytes.NewBuffer(nil)
+		stderr = bytes.NewBuffer(nil)
+		fn     = func(ctx context.Context, req *Request) (*Response, error) {
+			if req.RequestType == RequestTypeUpdate {
+				panic("boom")
+			}
+			if req.RequestType == RequestTypeDelete {
+				return nil, errors.New("access denied")
+			}
+			return &Response{PhysicalResourceId: "abc"}, nil
+		}
+	)
+
+	handler := New(fn, WithTransport(captureReply(t, &input)), WithOutput(stdout), WithErrorOutput(stderr))
+	for _, requestType := range []string{RequestTypeCreate, RequestTypeUpdate, RequestTypeDelete} {
+		data := marshalRequest(t, Request{RequestType: requestType, LogicalResourceId: "Resource"})
+		if _, err := handler.Invoke(ctx, data); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+	}
+
+	if got := stdout.String(); !strings.Contains(got, "Create succeeded") || strings.Contains(got, "[ERROR]") {
+		t.Fatalf("got %v; want successes only", got)
+	}
+	if got := stderr.String(); !strings.Contains(got, "Update failed - recovered from boom") || !strings.Contains(got, "Delete failed - access denied") {
+		t.Fatalf("got %v; want failures", got)
+	}
+	if got := stderr.String(); strings.Contains(got, "[INFO]") {
+		t.Fatalf("got %v; want errors only", got)
+	}
+
+	t.Run("default", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		handler := New(fn, WithTransport(captureReply(t, &input)), WithOutput(buf))
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeDelete})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if !strings.Contains(buf.String(), "[ERROR]") {
+			t.Fatalf("got %v; want errors in output", buf.String())
+		}
+	})
+}
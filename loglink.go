@@ -0,0 +1,65 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+// logLink returns the CloudWatch Logs console url of the log stream the
+// function is writing to, or "" when not running within Lambda
+func logLink(ctx context.Context) string {
+	stream := lambdacontext.LogStreamName
+	if stream == "" {
+		return ""
+	}
+
+	group := lambdacontext.LogGroupName
+	if group == "" && lambdacontext.FunctionName != "" {
+		group = "/aws/lambda/" + lambdacontext.FunctionName
+	}
+	if group == "" {
+		return ""
+	}
+
+	region := os.Getenv("AWS_REGION")
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		// arn:partition:lambda:region:account:function:name
+		if parts := strings.Split(lc.InvokedFunctionArn, ":"); len(parts) > 3 && parts[3] != "" {
+			region = parts[3]
+		}
+	}
+	if region == "" {
+		return ""
+	}
+
+	return "https://" + region + ".console.aws.amazon.com/cloudwatch/home?region=" + region +
+		"#logEventViewer:group=" + url.QueryEscape(group) + ";stream=" + url.QueryEscape(stream)
+}
+
+// WithLogLink controls whether failure reasons end with a link to the
+// CloudWatch Logs of the invocation so operators can go straight from the
+// stack events to the logs.  Disabled by default; the link is omitted when
+// not running within Lambda.
+func WithLogLink(enabled bool) Option {
+	return func(o *options) {
+		o.logLink = enabled
+	}
+}
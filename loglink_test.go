@@ -0,0 +1,90 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+func TestWithLogLink(t *testing.T) {
+	defer func(group, stream string) {
+		lambdacontext.LogGroupName, lambdacontext.LogStreamName = group, stream
+	}(lambdacontext.LogGroupName, lambdacontext.LogStreamName)
+	lambdacontext.LogGroupName = "/aws/lambda/widget"
+	lambdacontext.LogStreamName = "2019/02/12/[$LATEST]abc"
+
+	const link = " (logs: https://us-west-2.console.aws.amazon.com/cloudwatch/home?region=us-west-2#logEventViewer:group=%2Faws%2Flambda%2Fwidget;stream=2019%2F02%2F12%2F%5B%24LATEST%5Dabc)"
+
+	testCases := map[string]struct {
+		Opts   []Option
+		Reason string
+		Want   string
+	}{
+		"default": {
+			Reason: "boom",
+			Want:   "boom",
+		},
+		"enabled": {
+			Opts:   []Option{WithLogLink(true)},
+			Reason: "boom",
+			Want:   "boom" + link,
+		},
+		"truncated": {
+			Opts:   []Option{WithLogLink(true), WithMaxReasonLength(len(link) + 10)},
+			Reason: strings.Repeat("x", 20),
+			Want:   "xxxxxxx..." + link,
+		},
+		"too long": {
+			Opts:   []Option{WithLogLink(true), WithMaxReasonLength(len(link))},
+			Reason: "boom",
+			Want:   "boom",
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx = lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{
+					InvokedFunctionArn: "arn:aws:lambda:us-west-2:123456789012:function:widget",
+				})
+				input ReplyInput
+				fn    = func(ctx context.Context, req *Request) (*Response, error) {
+					return nil, errors.New(tc.Reason)
+				}
+			)
+
+			opts := append([]Option{WithTransport(captureReply(t, &input))}, tc.Opts...)
+			handler := New(fn, opts...)
+			if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Reason, tc.Want; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+
+	t.Run("not in lambda", func(t *testing.T) {
+		lambdacontext.LogStreamName = ""
+		if got := logLink(context.Background()); got != "" {
+			t.Fatalf("got %v; want empty", got)
+		}
+	})
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"errors"
+	"runtime"
+	"time"
+)
+
+// errMemoryThreshold is returned when the memory watchdog trips
+var errMemoryThreshold = errors.New("handler exceeded memory threshold")
+
+// memoryWatchdogInterval is how often the memory watchdog samples usage
+const memoryWatchdogInterval = 50 * time.Millisecond
+
+type memoryWatchdog struct {
+	threshold uint64 // bytes
+	interval  time.Duration
+}
+
+// memoryExceeded samples heap usage and returns true if it exceeds the
+// memory watchdog threshold
+func (h *Handler) memoryExceeded(req *Request) bool {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	if stats.HeapAlloc <= h.memoryWatchdog.threshold {
+		return false
+	}
+
+	h.logf(LogError, req, "%v: %v heap %vMB exceeds %vMB; canceling\n", req.LogicalResourceId, req.RequestType, stats.HeapAlloc>>20, h.memoryWatchdog.threshold>>20)
+	return true
+}
+
+// WithMemoryWatchdog periodically samples heap usage while the Func runs and,
+// if usage crosses thresholdMB, cancels the Func context and replies FAILED
+// with "handler exceeded memory threshold" before the Lambda is killed for
+// running out of memory.
+//
+// The watchdog is best-effort.  Allocations between samples may exhaust
+// memory before the watchdog notices, and the Func continues running in the
+// background until it observes the canceled context.  Set thresholdMB with
+// ample headroom below the configured Lambda memory.
+func WithMemoryWatchdog(thresholdMB int) Option {
+	return func(o *options) {
+		if thresholdMB > 0 {
+			o.memoryWatchdog = &memoryWatchdog{
+				threshold: uint64(thresholdMB) << 20,
+				interval:  memoryWatchdogInterval,
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestWithMemoryWatchdog(t *testing.T) {
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	thresholdMB := int(stats.HeapAlloc>>20) + 32
+
+	t.Run("exceeded", func(t *testing.T) {
+		var (
+			ctx   = context.Background()
+			input ReplyInput
+			done  = make(chan struct{})
+			fn    = func(ctx context.Context, req *Request) (*Response, error) {
+				defer close(done)
+				var hog [][]byte
+				for ctx.Err() == nil && len(hog) < 1024 {
+					hog = append(hog, make([]byte, 1<<20))
+					time.Sleep(time.Millisecond)
+				}
+				runtime.KeepAlive(hog)
+				return &Response{PhysicalResourceId: "abc"}, nil
+			}
+		)
+
+		handler := New(fn, WithTransport(captureReply(t, &input)), WithMemoryWatchdog(thresholdMB))
+		handler.memoryWatchdog.interval = 5 * time.Millisecond
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		<-done
+		runtime.GC()
+
+		if got, want := input.Status, StatusFailed; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := input.Reason, errMemoryThreshold.Error(); got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("within", func(t *testing.T) {
+		var (
+			ctx   = context.Background()
+			input ReplyInput
+			fn    = func(ctx context.Context, req *Request) (*Response, error) {
+				return &Response{PhysicalResourceId: "abc"}, nil
+			}
+		)
+
+		handler := New(fn, WithTransport(captureReply(t, &input)), WithMemoryWatchdog(thresholdMB))
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := input.Status, StatusSuccess; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"fmt"
+)
+
+type contextKey string
+
+// MetadataKey is the context key under which the Handler stores the Metadata
+// of the request being processed.  The ctx passed to the Func, and so to any
+// AWS SDK calls made with it, carries the Metadata e.g.
+//
+//	md, _ := ctx.Value(customresource.MetadataKey).(customresource.Metadata)
+//
+// MetadataFromContext provides a typed accessor.
+const MetadataKey contextKey = "customresource.metadata"
+
+// Metadata correlates calls made by a Func with the stack operation that
+// triggered it
+type Metadata struct {
+	StackId           string
+	LogicalResourceId string
+	RequestId         string
+	RequestType       string
+	// OperationId identifies the stack operation, if known; see OperationID
+	OperationId string
+}
+
+// String returns the ids in a form suitable for request metadata or logs
+// e.g. to append to the AWS SDK user agent from a Build handler:
+//
+//	if md, ok := customresource.MetadataFromContext(r.Context()); ok {
+//		request.AddToUserAgent(r, md.String())
+//	}
+func (m Metadata) String() string {
+	return fmt.Sprintf("cfn-stack/%v cfn-logical/%v cfn-request/%v", m.StackId, m.LogicalResourceId, m.RequestId)
+}
+
+// MetadataFromContext returns the Metadata of the request being processed
+func MetadataFromContext(ctx context.Context) (Metadata, bool) {
+	m, ok := ctx.Value(MetadataKey).(Metadata)
+	return m, ok
+}
+
+// StackIDFromContext returns the StackId of the request being processed or ""
+// if ctx was not passed to a Func
+func StackIDFromContext(ctx context.Context) string {
+	m, _ := MetadataFromContext(ctx)
+	return m.StackId
+}
+
+// RequestIDFromContext returns the RequestId of the request being processed
+// or "" if ctx was not passed to a Func
+func RequestIDFromContext(ctx context.Context) string {
+	m, _ := MetadataFromContext(ctx)
+	return m.RequestId
+}
+
+// LogicalResourceIDFromContext returns the LogicalResourceId of the request
+// being processed or "" if ctx was not passed to a Func
+func LogicalResourceIDFromContext(ctx context.Context) string {
+	m, _ := MetadataFromContext(ctx)
+	return m.LogicalResourceId
+}
+
+func newMetadata(req *Request) Metadata {
+	return Metadata{
+		StackId:           req.StackId,
+		LogicalResourceId: req.LogicalResourceId,
+		RequestId:         req.RequestId,
+		RequestType:       req.RequestType,
+		OperationId:       OperationID(req),
+	}
+}
+
+// OperationID returns the id of the stack operation that triggered req, e.g.
+// to group all resources changed by the same stack update, or "" if the
+// event does not carry one.  The ClientRequestToken is used when present.
+func OperationID(req *Request) string {
+	return req.ClientRequestToken
+}
@@ -0,0 +1,151 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestMetadataFromContext(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		input ReplyInput
+		got   Metadata
+		ok    bool
+		fn    = func(ctx context.Context, req *Request) (*Response, error) {
+			got, ok = MetadataFromContext(ctx)
+			return &Response{PhysicalResourceId: "abc"}, nil
+		}
+		req = Request{
+			RequestType:       RequestTypeCreate,
+			StackId:           "arn:aws:cloudformation:us-east-1:123456789012:stack/my-stack/guid",
+			LogicalResourceId: "Resource",
+			RequestId:         "request-id",
+		}
+	)
+
+	if _, ok := MetadataFromContext(ctx); ok {
+		t.Fatalf("got true; want false")
+	}
+
+	handler := New(fn, WithTransport(captureReply(t, &input)))
+	if _, err := handler.Invoke(ctx, marshalRequest(t, req)); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if !ok {
+		t.Fatalf("got false; want true")
+	}
+
+	want := Metadata{
+		StackId:           req.StackId,
+		LogicalResourceId: req.LogicalResourceId,
+		RequestId:         req.RequestId,
+		RequestType:       req.RequestType,
+	}
+	if got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := got.String(), "cfn-stack/"+req.StackId+" cfn-logical/Resource cfn-request/request-id"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+func TestIDsFromContext(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		input ReplyInput
+		got   []string
+		deep  = func(ctx context.Context) []string {
+			return []string{StackIDFromContext(ctx), LogicalResourceIDFromContext(ctx), RequestIDFromContext(ctx)}
+		}
+		fn = func(ctx context.Context, req *Request) (*Response, error) {
+			got = deep(ctx)
+			return &Response{PhysicalResourceId: "abc"}, nil
+		}
+		req = Request{
+			RequestType:       RequestTypeCreate,
+			StackId:           "stack-id",
+			LogicalResourceId: "Resource",
+			RequestId:         "request-id",
+		}
+	)
+
+	if got, want := fmt.Sprint(deep(ctx)), fmt.Sprint([]string{"", "", ""}); got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	handler := New(fn, WithTransport(captureReply(t, &input)))
+	if _, err := handler.Invoke(ctx, marshalRequest(t, req)); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := fmt.Sprint(got), fmt.Sprint([]string{"stack-id", "Resource", "request-id"}); got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+func TestOperationID(t *testing.T) {
+	testCases := map[string]struct {
+		Token  string
+		WantKV []interface{}
+	}{
+		"present": {
+			Token:  "operation-id",
+			WantKV: []interface{}{"logicalResourceId", "Resource", "requestType", RequestTypeCreate, "requestId", "request-id", "operationId", "operation-id"},
+		},
+		"absent": {
+			WantKV: []interface{}{"logicalResourceId", "Resource", "requestType", RequestTypeCreate, "requestId", "request-id"},
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx    = context.Background()
+				input  ReplyInput
+				logger = &recordingLogger{}
+				got    string
+				fn     = func(ctx context.Context, req *Request) (*Response, error) {
+					md, _ := MetadataFromContext(ctx)
+					got = md.OperationId
+					return &Response{PhysicalResourceId: "abc"}, nil
+				}
+				req = Request{
+					RequestType:        RequestTypeCreate,
+					LogicalResourceId:  "Resource",
+					RequestId:          "request-id",
+					ClientRequestToken: tc.Token,
+				}
+			)
+
+			handler := New(fn, WithTransport(captureReply(t, &input)), WithLogger(logger))
+			if _, err := handler.Invoke(ctx, marshalRequest(t, req)); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := got, tc.Token; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+
+			entry, ok := logger.find("Resource: Create succeeded. PhysicalResourceId=abc")
+			if !ok {
+				t.Fatalf("got false; want true")
+			}
+			if got, want := fmt.Sprint(entry.KV), fmt.Sprint(tc.WantKV); got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import "sync"
+
+const (
+	// metricReplyRetry counts retries of the reply PUT, labeled by outcome
+	metricReplyRetry = "reply_retry"
+	// metricTimeToReply observes the seconds from Invoke to a 2xx reply
+	metricTimeToReply = "time_to_reply"
+	// metricRequestDuration observes the seconds taken to compute the reply,
+	// labeled by requestType and status
+	metricRequestDuration = "request_duration"
+)
+
+const (
+	replyRetrySucceeded = "succeeded"
+	replyRetryExhausted = "exhausted"
+)
+
+// MetricsCollector receives the metrics emitted by the Handler
+//
+// Metrics emitted:
+//
+//	reply_retry        counter, one per retry of the reply; labeled by outcome, succeeded or exhausted
+//	time_to_reply      seconds from Invoke until the reply received a 2xx; labeled by requestType, and coldStart with WithColdStart
+//	request_duration   seconds taken to compute the reply, whether or not it was delivered; labeled by requestType and status, SUCCESS or FAILED, including Funcs that panicked
+type MetricsCollector interface {
+	// Add increments the counter, name, by value
+	Add(name string, value float64, labels map[string]string)
+	// Observe records a single observation of name e.g. a duration in seconds
+	Observe(name string, value float64, labels map[string]string)
+}
+
+// WithMetricsCollector sends the metrics emitted by the Handler to collector.
+// By default, metrics are discarded.  See MemoryMetricsCollector for tests.
+func WithMetricsCollector(collector MetricsCollector) Option {
+	return func(o *options) {
+		o.metrics = collector
+	}
+}
+
+// Metric is a single value recorded by MemoryMetricsCollector
+type Metric struct {
+	Name   string
+	Value  float64
+	Labels map[string]string
+}
+
+// MemoryMetricsCollector records metrics in memory so tests can assert on them
+type MemoryMetricsCollector struct {
+	mutex        sync.Mutex
+	counters     []Metric
+	observations []Metric
+}
+
+// NewMemoryMetricsCollector returns a new MemoryMetricsCollector
+func NewMemoryMetricsCollector() *MemoryMetricsCollector {
+	return &MemoryMetricsCollector{}
+}
+
+// newMetric copies labels as the caller may reuse them
+func newMetric(name string, value float64, labels map[string]string) Metric {
+	copied := make(map[string]string, len(labels))
+	for k, v := range labels {
+		copied[k] = v
+	}
+	return Metric{Name: name, Value: value, Labels: copied}
+}
+
+// Add implements MetricsCollector
+func (m *MemoryMetricsCollector) Add(name string, value float64, labels map[string]string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.counters = append(m.counters, newMetric(name, value, labels))
+}
+
+// Observe implements MetricsCollector
+func (m *MemoryMetricsCollector) Observe(name string, value float64, labels map[string]string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.observations = append(m.observations, newMetric(name, value, labels))
+}
+
+// Counters returns the counter increments, named name, recorded so far
+func (m *MemoryMetricsCollector) Counters(name string) []Metric {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return filterMetrics(m.counters, name)
+}
+
+// Observations returns the observations, named name, recorded so far
+func (m *MemoryMetricsCollector) Observations(name string) []Metric {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return filterMetrics(m.observations, name)
+}
+
+func filterMetrics(metrics []Metric, name string) []Metric {
+	var filtered []Metric
+	for _, metric := range metrics {
+		if metric.Name == name {
+			filtered = append(filtered, metric)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,252 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeCollector struct {
+	mutex        sync.Mutex
+	counters     map[string]float64
+	observations map[string][]float64
+	labels       map[string][]map[string]string
+}
+
+func (f *fakeCollector) Observe(name string, value float64, labels map[string]string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.observations == nil {
+		f.observations = map[string][]float64{}
+	}
+	f.observations[name] = append(f.observations[name], value)
+	if f.labels == nil {
+		f.labels = map[string][]map[string]string{}
+	}
+	f.labels[name] = append(f.labels[name], labels)
+}
+
+func (f *fakeCollector) Add(name string, value float64, labels map[string]string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.counters == nil {
+		f.counters = map[string]float64{}
+	}
+	key := name
+	if outcome, ok := labels["outcome"]; ok {
+		key += ":" + outcome
+	}
+	f.counters[key] += value
+}
+
+func TestReplyRetryMetrics(t *testing.T) {
+	testCases := map[string]struct {
+		Failures int
+		Attempts int
+		Counters map[string]float64
+		Err      bool
+	}{
+		"no retries": {
+			Attempts: 3,
+			Counters: map[string]float64{},
+		},
+		"succeeded": {
+			Failures: 2,
+			Attempts: 3,
+			Counters: map[string]float64{"reply_retry:succeeded": 2},
+		},
+		"exhausted": {
+			Failures: 5,
+			Attempts: 3,
+			Counters: map[string]float64{"reply_retry:exhausted": 2},
+			Err:      true,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx       = context.Background()
+				input     ReplyInput
+				calls     int
+				collector = &fakeCollector{counters: map[string]float64{}}
+				rt        = func(req *http.Request) (*http.Response, error) {
+					calls++
+					if calls <= tc.Failures {
+						return nil, errors.New("connection reset")
+					}
+					return captureReply(t, &input)(req)
+				}
+				fn = func(ctx context.Context, req *Request) (*Response, error) {
+					return &Response{PhysicalResourceId: "abc"}, nil
+				}
+			)
+
+			handler := New(fn,
+				WithTransport(transportFunc(rt)),
+				WithReplyRetry(tc.Attempts, time.Millisecond),
+				WithMetricsCollector(collector),
+			)
+			_, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate}))
+			if got, want := err != nil, tc.Err; got != want {
+				t.Fatalf("got %v; want %v", err, want)
+			}
+			if got, want := len(collector.counters), len(tc.Counters); got != want {
+				t.Fatalf("got %v; want %v", collector.counters, tc.Counters)
+			}
+			for k, want := range tc.Counters {
+				if got := collector.counters[k]; got != want {
+					t.Fatalf("got %v; want %v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTimeToReplyMetric(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var (
+			ctx       = context.Background()
+			input     ReplyInput
+			clock     = &fakeClock{now: time.Unix(1550000000, 0)}
+			collector = &fakeCollector{}
+			rt        = func(req *http.Request) (*http.Response, error) {
+				clock.Advance(2 * time.Second) // simulated reply latency
+				return captureReply(t, &input)(req)
+			}
+			fn = func(ctx context.Context, req *Request) (*Response, error) {
+				clock.Advance(3 * time.Second) // simulated handler latency
+				return &Response{PhysicalResourceId: "abc"}, nil
+			}
+		)
+
+		handler := New(fn, WithTransport(transportFunc(rt)), WithMetricsCollector(collector), withClock(clock))
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := collector.observations[metricTimeToReply], []float64{5}; len(got) != 1 || got[0] != want[0] {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("non 2xx", func(t *testing.T) {
+		var (
+			ctx       = context.Background()
+			collector = &fakeCollector{}
+			rt        = func(req *http.Request) (*http.Response, error) {
+				w := httptest.NewRecorder()
+				w.WriteHeader(http.StatusForbidden)
+				return w.Result(), nil
+			}
+			fn = func(ctx context.Context, req *Request) (*Response, error) {
+				return &Response{PhysicalResourceId: "abc"}, nil
+			}
+		)
+
+		handler := New(fn, WithTransport(transportFunc(rt)), WithMetricsCollector(collector))
+		handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate}))
+		if got := collector.observations[metricTimeToReply]; len(got) != 0 {
+			t.Fatalf("got %v; want none", got)
+		}
+	})
+}
+
+func TestRequestDuration(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		input     ReplyInput
+		clock     = &fakeClock{now: time.Unix(1550000000, 0)}
+		collector = &fakeCollector{}
+		fn        = func(ctx context.Context, req *Request) (*Response, error) {
+			clock.Advance(time.Second)
+			switch req.RequestType {
+			case RequestTypeUpdate:
+				return nil, errors.New("boom")
+			case RequestTypeDelete:
+				panic("boom")
+			}
+			return &Response{PhysicalResourceId: "abc"}, nil
+		}
+	)
+
+	handler := New(fn, WithTransport(captureReply(t, &input)), WithMetricsCollector(collector), withClock(clock))
+	for _, requestType := range []string{RequestTypeCreate, RequestTypeUpdate, RequestTypeDelete} {
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: requestType, PhysicalResourceId: "abc"})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+	}
+
+	if got, want := collector.observations[metricRequestDuration], []float64{1, 1, 1}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	want := []map[string]string{
+		{"requestType": RequestTypeCreate, "status": StatusSuccess},
+		{"requestType": RequestTypeUpdate, "status": StatusFailed},
+		{"requestType": RequestTypeDelete, "status": StatusFailed},
+	}
+	if got := collector.labels[metricRequestDuration]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+func TestMemoryMetricsCollector(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		input     ReplyInput
+		clock     = &fakeClock{now: time.Unix(1550000000, 0)}
+		collector = NewMemoryMetricsCollector()
+		fn        = func(ctx context.Context, req *Request) (*Response, error) {
+			clock.Advance(time.Second)
+			if req.RequestType == RequestTypeDelete {
+				panic("boom")
+			}
+			return &Response{PhysicalResourceId: "abc"}, nil
+		}
+	)
+
+	handler := New(fn, WithTransport(captureReply(t, &input)), WithMetricsCollector(collector), withClock(clock))
+	for _, requestType := range []string{RequestTypeCreate, RequestTypeDelete} {
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: requestType, PhysicalResourceId: "abc"})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+	}
+
+	want := []Metric{
+		{Name: metricRequestDuration, Value: 1, Labels: map[string]string{"requestType": RequestTypeCreate, "status": StatusSuccess}},
+		{Name: metricRequestDuration, Value: 1, Labels: map[string]string{"requestType": RequestTypeDelete, "status": StatusFailed}},
+	}
+	if got := collector.Observations(metricRequestDuration); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got := collector.Counters(metricReplyRetry); len(got) != 0 {
+		t.Fatalf("got %v; want none", got)
+	}
+
+	labels := map[string]string{"outcome": replyRetrySucceeded}
+	collector.Add(metricReplyRetry, 1, labels)
+	labels["outcome"] = replyRetryExhausted
+	if got, want := collector.Counters(metricReplyRetry), []Metric{{Name: metricReplyRetry, Value: 1, Labels: map[string]string{"outcome": replyRetrySucceeded}}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
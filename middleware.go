@@ -0,0 +1,45 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"time"
+)
+
+// Middleware decorates a Func with cross-cutting behavior e.g. timing,
+// tracing, or validation of the ResourceProperties
+type Middleware func(Func) Func
+
+// LogDuration is an example Middleware that logs the request type and how
+// long the Func took to complete
+func LogDuration(next Func) Func {
+	return func(ctx context.Context, req *Request) (*Response, error) {
+		started := time.Now()
+		defer func() {
+			logf(ctx, LogInfo, "%v: %v took %v\n", req.LogicalResourceId, req.RequestType, time.Since(started))
+		}()
+		return next(ctx, req)
+	}
+}
+
+// WithMiddleware wraps the Func with middleware.  The first middleware is the
+// outermost and so runs first.  Middleware runs within the panic recovery
+// that protects the Func.
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(o *options) {
+		o.middleware = append(o.middleware, middleware...)
+	}
+}
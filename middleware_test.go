@@ -0,0 +1,106 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWithMiddleware(t *testing.T) {
+	t.Run("order", func(t *testing.T) {
+		var (
+			ctx   = context.Background()
+			input ReplyInput
+			calls []string
+			fn    = func(ctx context.Context, req *Request) (*Response, error) {
+				calls = append(calls, "fn")
+				return &Response{PhysicalResourceId: "abc"}, nil
+			}
+			middleware = func(name string) Middleware {
+				return func(next Func) Func {
+					return func(ctx context.Context, req *Request) (*Response, error) {
+						calls = append(calls, name+" before")
+						resp, err := next(ctx, req)
+						calls = append(calls, name+" after")
+						return resp, err
+					}
+				}
+			}
+		)
+
+		handler := New(fn,
+			WithTransport(captureReply(t, &input)),
+			WithMiddleware(middleware("a"), middleware("b")),
+			WithMiddleware(middleware("c")),
+		)
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+
+		want := []string{"a before", "b before", "c before", "fn", "c after", "b after", "a after"}
+		if got := calls; !reflect.DeepEqual(got, want) {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		var (
+			ctx   = context.Background()
+			input ReplyInput
+			fn    = func(ctx context.Context, req *Request) (*Response, error) {
+				return &Response{PhysicalResourceId: "abc"}, nil
+			}
+			panics = func(next Func) Func {
+				return func(ctx context.Context, req *Request) (*Response, error) {
+					panic("boom")
+				}
+			}
+		)
+
+		handler := New(fn, WithTransport(captureReply(t, &input)), WithMiddleware(panics))
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := input.Status, StatusFailed; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := input.Reason, "recovered from boom"; !strings.HasPrefix(got, want) {
+			t.Fatalf("got %v; want prefix %v", got, want)
+		}
+	})
+
+	t.Run("log duration", func(t *testing.T) {
+		var (
+			ctx   = context.Background()
+			input ReplyInput
+			buf   = &bytes.Buffer{}
+			fn    = func(ctx context.Context, req *Request) (*Response, error) {
+				return &Response{PhysicalResourceId: "abc"}, nil
+			}
+		)
+
+		handler := New(fn, WithTransport(captureReply(t, &input)), WithOutput(buf), WithMiddleware(LogDuration))
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate, LogicalResourceId: "Resource"})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := buf.String(), "[INFO] Resource: Create took "; !strings.Contains(got, want) {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+}
@@ -0,0 +1,181 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sync"
+)
+
+// propertiesUnchanged returns true if the ResourceProperties of an Update
+// are equivalent to the OldResourceProperties
+func propertiesUnchanged(req *Request) bool {
+	if req.RequestType != RequestTypeUpdate || len(req.OldResourceProperties) == 0 {
+		return false
+	}
+
+	var props, oldProps interface{}
+	if err := json.Unmarshal(req.ResourceProperties, &props); err != nil {
+		return false
+	}
+	if err := json.Unmarshal(req.OldResourceProperties, &oldProps); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(props, oldProps)
+}
+
+// ReplayStore records the Data of the most recent successful reply for each
+// resource so WithNoOpUpdateReplay can replay it.  The store must be shared
+// across Lambda containers; production users typically supply one backed by
+// DynamoDB.  Data may include NoEcho values so the store should encrypt it at
+// rest.
+type ReplayStore interface {
+	// Load returns the Data recorded for key or nil if none has been recorded
+	Load(ctx context.Context, key string) (map[string]interface{}, error)
+	// Save records data for key
+	Save(ctx context.Context, key string, data map[string]interface{}) error
+	// Delete removes the Data recorded for key
+	Delete(ctx context.Context, key string) error
+}
+
+// MemoryReplayStore keeps recorded Data in a map for tests
+type MemoryReplayStore struct {
+	mutex sync.Mutex
+	data  map[string]map[string]interface{}
+}
+
+// NewMemoryReplayStore returns a new MemoryReplayStore
+func NewMemoryReplayStore() *MemoryReplayStore {
+	return &MemoryReplayStore{
+		data: map[string]map[string]interface{}{},
+	}
+}
+
+// Load implements ReplayStore
+func (m *MemoryReplayStore) Load(ctx context.Context, key string) (map[string]interface{}, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.data[key], nil
+}
+
+// Save implements ReplayStore
+func (m *MemoryReplayStore) Save(ctx context.Context, key string, data map[string]interface{}) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.data[key] = data
+	return nil
+}
+
+// Delete implements ReplayStore
+func (m *MemoryReplayStore) Delete(ctx context.Context, key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.data, key)
+	return nil
+}
+
+// replayKey identifies the resource whose Data is recorded
+func replayKey(req *Request, physicalID string) string {
+	return req.StackId + "/" + req.LogicalResourceId + "/" + physicalID
+}
+
+// noOpUpdateReplay replays the Data recorded in store for Updates whose
+// properties are unchanged, without calling next
+func noOpUpdateReplay(store ReplayStore) Middleware {
+	return func(next Func) Func {
+		return func(ctx context.Context, req *Request) (*Response, error) {
+			if propertiesUnchanged(req) {
+				data, err := store.Load(ctx, replayKey(req, req.PhysicalResourceId))
+				if err != nil {
+					logf(ctx, LogWarn, "%v: unable to replay Data - %v\n", req.LogicalResourceId, err)
+				}
+				if data != nil {
+					logf(ctx, LogInfo, "%v: %v properties unchanged; replaying prior Data\n", req.LogicalResourceId, req.RequestType)
+					TraceRoute(ctx, "noOpUpdateReplay")
+					return &Response{PhysicalResourceId: req.PhysicalResourceId, Data: data}, nil
+				}
+			}
+
+			return next(ctx, req)
+		}
+	}
+}
+
+// recordReplay records the Data of a SUCCESS reply, once the ResponseURL has
+// accepted it, under the PhysicalResourceId actually sent.  The record is
+// removed once the resource is deleted.
+func (h *Handler) recordReplay(ctx context.Context, req *Request, input *ReplyInput) {
+	if input.Status != StatusSuccess {
+		return
+	}
+
+	key := replayKey(req, input.PhysicalResourceId)
+	if req.RequestType == RequestTypeDelete {
+		if err := h.noOpUpdateReplay.Delete(ctx, key); err != nil {
+			h.logf(LogWarn, req, "%v: unable to remove recorded Data - %v\n", req.LogicalResourceId, err)
+		}
+		return
+	}
+
+	data := replayData(input.Data)
+	if len(data) == 0 {
+		return
+	}
+	if err := h.noOpUpdateReplay.Save(ctx, key, data); err != nil {
+		h.logf(LogWarn, req, "%v: unable to record Data for replay - %v\n", req.LogicalResourceId, err)
+	}
+}
+
+// replayData returns the Data of a reply as a map, less the version added by
+// WithOutputSchema, which is added again when the Data is replayed
+func replayData(v interface{}) map[string]interface{} {
+	var data map[string]interface{}
+	switch d := v.(type) {
+	case map[string]interface{}:
+		data = d
+	case json.RawMessage:
+		if err := json.Unmarshal(d, &data); err != nil {
+			return nil
+		}
+	}
+	if _, ok := data[SchemaVersionKey]; !ok {
+		return data
+	}
+
+	copied := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		if k != SchemaVersionKey {
+			copied[k] = v
+		}
+	}
+	return copied
+}
+
+// WithNoOpUpdateReplay avoids calling the Func for Updates that change none
+// of the ResourceProperties.  The Data of each successful Create and Update
+// is recorded in store, keyed by stack, logical id, and PhysicalResourceId,
+// once the ResponseURL accepts the reply, so a no-op Update replies SUCCESS with the prior Data and !GetAtt outputs
+// are not lost.  The PhysicalResourceId is left as the Func returned it.  If
+// the prior Data cannot be recovered, the Func is called as usual.
+func WithNoOpUpdateReplay(store ReplayStore) Option {
+	return func(o *options) {
+		o.noOpUpdateReplay = store
+	}
+}
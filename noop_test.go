@@ -0,0 +1,210 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestWithNoOpUpdateReplay(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		input ReplyInput
+		calls []string
+		store = NewMemoryReplayStore()
+		fn    = func(ctx context.Context, req *Request) (*Response, error) {
+			calls = append(calls, req.RequestType+" "+req.PhysicalResourceId)
+
+			var props map[string]interface{}
+			if err := json.Unmarshal(req.ResourceProperties, &props); err != nil {
+				return nil, err
+			}
+			return &Response{
+				PhysicalResourceId: "widget",
+				Data:               map[string]interface{}{"Name": props["Name"], "Password": "hunter2"},
+				NoEcho:             true,
+			}, nil
+		}
+		handler = New(fn, WithTransport(captureReply(t, &input)), WithNoOpUpdateReplay(store))
+	)
+
+	invoke := func(requestType, physicalID, props, oldProps string) {
+		t.Helper()
+		req := Request{
+			RequestType:        requestType,
+			StackId:            "stack",
+			LogicalResourceId:  "Resource",
+			PhysicalResourceId: physicalID,
+			ResourceProperties: json.RawMessage(props),
+		}
+		if oldProps != "" {
+			req.OldResourceProperties = json.RawMessage(oldProps)
+		}
+		calls = nil
+		if _, err := handler.Invoke(ctx, marshalRequest(t, req)); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := input.Status, StatusSuccess; got != want {
+			t.Fatalf("got %v (%v); want %v", got, input.Reason, want)
+		}
+	}
+
+	invoke(RequestTypeCreate, "", `{"Name":"a"}`, "")
+	if got, want := input.PhysicalResourceId, "widget"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	t.Run("no-op", func(t *testing.T) {
+		invoke(RequestTypeUpdate, "widget", `{"Name":"a"}`, `{"Name": "a"}`)
+		if got := calls; len(got) != 0 {
+			t.Fatalf("got %v; want no calls", got)
+		}
+		if got, want := input.PhysicalResourceId, "widget"; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		want := map[string]interface{}{"Name": "a", "Password": "hunter2"}
+		if got := input.Data; !reflect.DeepEqual(got, interface{}(want)) {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		invoke(RequestTypeUpdate, "widget", `{"Name":"b"}`, `{"Name":"a"}`)
+		if got, want := calls, []string{"Update widget"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := input.PhysicalResourceId, "widget"; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+
+		// the Data of the Update is replayed from now on
+		invoke(RequestTypeUpdate, "widget", `{"Name":"b"}`, `{"Name":"b"}`)
+		if got := calls; len(got) != 0 {
+			t.Fatalf("got %v; want no calls", got)
+		}
+		if got, want := input.Data.(map[string]interface{})["Name"], "b"; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("unrecorded", func(t *testing.T) {
+		invoke(RequestTypeUpdate, "other", `{"Name":"a"}`, `{"Name":"a"}`)
+		if got, want := calls, []string{"Update other"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		invoke(RequestTypeDelete, "widget", `{"Name":"a"}`, "")
+		if got, want := calls, []string{"Delete widget"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if data, _ := store.Load(ctx, "stack/Resource/widget"); data != nil {
+			t.Fatalf("got %v; want nil", data)
+		}
+	})
+}
+
+func TestNoOpUpdateReplayRecording(t *testing.T) {
+	var (
+		data   = map[string]interface{}{"Name": "a"}
+		create = Request{
+			RequestType:        RequestTypeCreate,
+			StackId:            "stack",
+			LogicalResourceId:  "Resource",
+			ResourceProperties: json.RawMessage(`{"Name":"a"}`),
+		}
+	)
+
+	t.Run("default physical id", func(t *testing.T) {
+		var (
+			ctx   = context.Background()
+			input ReplyInput
+			calls int
+			store = NewMemoryReplayStore()
+			fn    = func(ctx context.Context, req *Request) (*Response, error) {
+				calls++
+				return &Response{Data: data}, nil
+			}
+		)
+
+		handler := New(fn, WithTransport(captureReply(t, &input)), WithNoOpUpdateReplay(store))
+		if _, err := handler.Invoke(ctx, marshalRequest(t, create)); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+
+		update := create
+		update.RequestType = RequestTypeUpdate
+		update.PhysicalResourceId = input.PhysicalResourceId
+		update.OldResourceProperties = create.ResourceProperties
+		if _, err := handler.Invoke(ctx, marshalRequest(t, update)); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := calls, 1; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got := input.Data; !reflect.DeepEqual(got, interface{}(data)) {
+			t.Fatalf("got %v; want %v", got, data)
+		}
+	})
+
+	t.Run("undelivered not recorded", func(t *testing.T) {
+		var (
+			ctx       = context.Background()
+			store     = NewMemoryReplayStore()
+			transport = transportFunc(func(req *http.Request) (*http.Response, error) {
+				return nil, errors.New("connection reset")
+			})
+			fn = func(ctx context.Context, req *Request) (*Response, error) {
+				return &Response{PhysicalResourceId: "abc", Data: data}, nil
+			}
+		)
+
+		handler := New(fn, WithTransport(transport), WithNoOpUpdateReplay(store))
+		if _, err := handler.Invoke(ctx, marshalRequest(t, create)); err == nil {
+			t.Fatalf("got nil; want err")
+		}
+		if got, want := len(store.data), 0; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("invalid response not recorded", func(t *testing.T) {
+		var (
+			ctx   = context.Background()
+			input ReplyInput
+			store = NewMemoryReplayStore()
+			fn    = func(ctx context.Context, req *Request) (*Response, error) {
+				return &Response{PhysicalResourceId: "abc", Data: map[string]interface{}{"a": "1", "b": "2"}}, nil
+			}
+		)
+
+		handler := New(fn, WithTransport(captureReply(t, &input)), WithNoOpUpdateReplay(store), WithMaxDataAttributes(1))
+		if _, err := handler.Invoke(ctx, marshalRequest(t, create)); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := input.Status, StatusFailed; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := len(store.data), 0; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+}
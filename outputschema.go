@@ -0,0 +1,85 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SchemaVersionKey is the Data key holding the version set by WithOutputSchema
+const SchemaVersionKey = "_SchemaVersion"
+
+type outputSchema struct {
+	version string
+	schema  *jsonSchema
+	err     error // schema could not be compiled
+}
+
+// validate returns an error if the data sent for resp, the RawData when set
+// and the Data otherwise, does not conform to the schema
+func (o *outputSchema) validate(resp *Response) error {
+	if o.err != nil {
+		return fmt.Errorf("invalid output schema, %v: %v", o.version, o.err)
+	}
+	if o.schema == nil {
+		return nil
+	}
+
+	var data interface{} = resp.Data
+	if resp.RawData != nil {
+		data = resp.RawData
+	} else if resp.Data == nil {
+		data = map[string]interface{}{}
+	}
+	fields, err := o.schema.validateJSON("Data", data)
+	if err != nil {
+		return fmt.Errorf("unable to validate Data against output schema, %v: %v", o.version, err)
+	}
+	if len(fields) > 0 {
+		messages := make([]string, 0, len(fields))
+		for _, f := range fields {
+			messages = append(messages, f.String())
+		}
+		return fmt.Errorf("Data does not match output schema, %v: %v", o.version, strings.Join(messages, "; "))
+	}
+
+	return nil
+}
+
+// inject returns a copy of data containing the schema version
+func (o *outputSchema) inject(data map[string]interface{}) map[string]interface{} {
+	injected := make(map[string]interface{}, len(data)+1)
+	for k, v := range data {
+		injected[k] = v
+	}
+	injected[SchemaVersionKey] = o.version
+	return injected
+}
+
+// WithOutputSchema adds the version, under the key _SchemaVersion, to the
+// Data of successful replies so consumers may branch on it via !GetAtt.  If
+// schema is provided, the Data returned by the Func, or the RawData when set,
+// is validated against it, prior to adding the version, and a FAILED reply is
+// sent if it does not conform.  The version is not added to RawData.  See jsonschema.go for the supported subset of JSON Schema.
+func WithOutputSchema(version string, schema []byte) Option {
+	return func(o *options) {
+		s := &outputSchema{version: version}
+		if len(schema) > 0 {
+			s.schema, s.err = compileSchema(schema)
+		}
+		o.outputSchema = s
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestWithOutputSchema(t *testing.T) {
+	const schema = `{
+		"type": "object",
+		"required": ["Arn"],
+		"properties": {
+			"Arn":  {"type": "string", "pattern": "^arn:"},
+			"Port": {"type": "integer", "minimum": 1}
+		}
+	}`
+
+	testCases := map[string]struct {
+		Schema  []byte
+		Data    map[string]interface{}
+		RawData json.RawMessage
+		Status  string
+		Reason  string
+	}{
+		"version only": {
+			Data:   map[string]interface{}{"Name": "blah"},
+			Status: StatusSuccess,
+		},
+		"valid": {
+			Schema: []byte(schema),
+			Data:   map[string]interface{}{"Arn": "arn:aws:s3:::bucket", "Port": 443},
+			Status: StatusSuccess,
+		},
+		"invalid": {
+			Schema: []byte(schema),
+			Data:   map[string]interface{}{"Arn": "bucket", "Port": 0},
+			Status: StatusFailed,
+			Reason: "Data does not match output schema, v2: Data.Arn: must match pattern ^arn:; Data.Port: must be at least 1",
+		},
+		"missing": {
+			Schema: []byte(schema),
+			Status: StatusFailed,
+			Reason: "Data does not match output schema, v2: Data.Arn: is required",
+		},
+		"raw valid": {
+			Schema:  []byte(schema),
+			RawData: json.RawMessage(`{"Arn":"arn:aws:s3:::bucket"}`),
+			Status:  StatusSuccess,
+		},
+		"raw invalid": {
+			Schema:  []byte(schema),
+			Data:    map[string]interface{}{"Arn": "arn:aws:s3:::bucket"},
+			RawData: json.RawMessage(`{"Arn":"bucket"}`),
+			Status:  StatusFailed,
+			Reason:  "Data does not match output schema, v2: Data.Arn: must match pattern ^arn:",
+		},
+		"bad schema": {
+			Schema: []byte(`{"type":`),
+			Status: StatusFailed,
+			Reason: "invalid output schema, v2: unable to parse schema: unexpected end of JSON input",
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx   = context.Background()
+				input ReplyInput
+				fn    = func(ctx context.Context, req *Request) (*Response, error) {
+					return &Response{PhysicalResourceId: "abc", Data: tc.Data, RawData: tc.RawData}, nil
+				}
+			)
+
+			handler := New(fn, WithTransport(captureReply(t, &input)), WithOutputSchema("v2", tc.Schema))
+			if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Status, tc.Status; got != want {
+				t.Fatalf("got %v; want %v: %v", got, want, input.Reason)
+			}
+			if got, want := input.Reason, tc.Reason; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if tc.Status != StatusSuccess || tc.RawData != nil {
+				return
+			}
+
+			data := input.Data.(map[string]interface{})
+			if got, want := data[SchemaVersionKey], "v2"; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if _, ok := tc.Data[SchemaVersionKey]; ok {
+				t.Fatalf("got handler Data modified; want copy")
+			}
+		})
+	}
+}
+
+func TestWithOutputSchemaLimits(t *testing.T) {
+	testCases := map[string]struct {
+		Opts   []Option
+		Reason string
+	}{
+		"attributes": {
+			Opts:   []Option{WithMaxDataAttributes(1)},
+			Reason: "handler returned 2 Data attributes; at most 1 are allowed",
+		},
+		"size": {
+			Opts:   []Option{WithMaxDataSize(len(`{"A":"x"}`))},
+			Reason: `handler returned 31 bytes of Data; at most 9 bytes are allowed`,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx   = context.Background()
+				input ReplyInput
+				fn    = func(ctx context.Context, req *Request) (*Response, error) {
+					return &Response{PhysicalResourceId: "abc", Data: map[string]interface{}{"A": "x"}}, nil
+				}
+			)
+
+			opts := append([]Option{WithTransport(captureReply(t, &input)), WithOutputSchema("v2", nil)}, tc.Opts...)
+			handler := New(fn, opts...)
+			if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Status, StatusFailed; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := input.Reason, tc.Reason; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
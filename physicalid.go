@@ -0,0 +1,140 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// defaultPhysicalID returns the PhysicalResourceId from the request if present
+// or a physical id derived from the StackId and LogicalResourceId.  The
+// derived id is stable across retries of the same request.
+func defaultPhysicalID(req *Request) string {
+	if req.PhysicalResourceId != "" {
+		return req.PhysicalResourceId
+	}
+
+	sum := sha256.Sum256([]byte(req.StackId + "/" + req.LogicalResourceId))
+	return fmt.Sprintf("%v-%x", req.LogicalResourceId, sum[:6])
+}
+
+// fillPhysicalID sets the PhysicalResourceId of a Response that omits one.
+// Update and Delete carry forward the id from the request while Create
+// generates one, unless WithStrictPhysicalID is set.
+func (h *Handler) fillPhysicalID(req *Request, resp *Response) {
+	if resp.PhysicalResourceId != "" {
+		return
+	}
+	switch {
+	case req.PhysicalResourceId != "":
+		resp.PhysicalResourceId = req.PhysicalResourceId
+	case h.strictPhysicalID && req.RequestType == RequestTypeCreate:
+		// left empty so the Create is rejected
+	default:
+		resp.PhysicalResourceId = h.physicalResourceID(req)
+	}
+}
+
+// WithPhysicalResourceID generates the PhysicalResourceId used when the Func
+// leaves it blank on Create.  By default, the id is derived from the StackId
+// and LogicalResourceId so it is stable across retries.
+func WithPhysicalResourceID(fn func(req *Request) string) Option {
+	return func(o *options) {
+		if fn == nil {
+			fn = defaultPhysicalID
+		}
+		o.physicalResourceID = fn
+	}
+}
+
+// Replace marks resp, the response to an Update, as replacing the resource
+// with a new one identified by newID.  The contract is:
+//
+//   - the Func has already created the new resource; newID must differ from
+//     the PhysicalResourceId of the request
+//   - once the stack update completes, CloudFormation sends a Delete for the
+//     old PhysicalResourceId, which must remove only the old resource
+//   - if the stack update rolls back instead, CloudFormation sends a Delete
+//     for newID while the old resource remains in use
+//
+// Returning the existing PhysicalResourceId updates the resource in place.
+func Replace(resp *Response, newID string) {
+	resp.PhysicalResourceId = newID
+}
+
+// failedCreatePrefix prefixes the PhysicalResourceId of a failed Create
+const failedCreatePrefix = "failed-create-"
+
+// failurePhysicalID returns the PhysicalResourceId to send with a FAILED
+// reply; never empty.  CloudFormation issues a Delete with this id when
+// rolling back a failed Create so it must identify whatever the Func created.
+// If the Func returned an id before failing e.g. verification or validation of
+// its Response failed, that id is sent.  If the Func is still running, having
+// been abandoned by a watchdog or not yet ready, the default id is sent as the
+// resource may yet be created.  Only when the Func returned without an id is
+// the never-created sentinel sent.
+func (h *Handler) failurePhysicalID(req *Request, resp *Response, err error) string {
+	switch {
+	case req.PhysicalResourceId != "":
+		return req.PhysicalResourceId
+	case resp != nil && resp.PhysicalResourceId != "" && !neverCreated(resp.PhysicalResourceId):
+		return resp.PhysicalResourceId
+	case resp != nil && resp.PhysicalResourceId != "", inProgress(err):
+		// the Func created something, but under a reserved id, or may yet
+		return h.physicalResourceID(req)
+	default:
+		return failedCreatePrefix + req.RequestId
+	}
+}
+
+// inProgress returns true if err indicates the Func may still be creating the
+// resource
+func inProgress(err error) bool {
+	return errors.Is(err, errHandlerTimedOut) || errors.Is(err, errMemoryThreshold) || errors.Is(err, ErrNotReady)
+}
+
+// neverCreated returns true if id is the PhysicalResourceId sent by a failed
+// Create.  CloudFormation issues a Delete for it while rolling back; there is
+// nothing to delete so the Func is not called.  The prefix is reserved; a Func
+// that returns a new id using it is rejected by validateResponse.
+func neverCreated(id string) bool {
+	return strings.HasPrefix(id, failedCreatePrefix)
+}
+
+// PrintableASCII returns an error if id contains anything other than
+// printable ASCII characters e.g. newlines, control characters, or unicode
+func PrintableASCII(id string) error {
+	for i, r := range id {
+		if r < ' ' || r > '~' {
+			return fmt.Errorf("invalid character %q at offset %v", r, i)
+		}
+	}
+	return nil
+}
+
+// WithPhysicalIDValidator replies FAILED when validate returns an error for
+// the PhysicalResourceId returned by the Func.  If validate is nil,
+// PrintableASCII is used.
+func WithPhysicalIDValidator(validate func(string) error) Option {
+	return func(o *options) {
+		if validate == nil {
+			validate = PrintableASCII
+		}
+		o.physicalIDValidator = validate
+	}
+}
@@ -0,0 +1,436 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWithPhysicalIDValidator(t *testing.T) {
+	testCases := map[string]struct {
+		ID       string
+		Validate func(string) error
+		Status   string
+	}{
+		"clean": {
+			ID:     "arn:aws:s3:::my-bucket",
+			Status: StatusSuccess,
+		},
+		"newline": {
+			ID:     "line one\nline two",
+			Status: StatusFailed,
+		},
+		"control character": {
+			ID:     "abc\x00def",
+			Status: StatusFailed,
+		},
+		"unicode": {
+			ID:     "bücket",
+			Status: StatusFailed,
+		},
+		"custom": {
+			ID: "abc",
+			Validate: func(id string) error {
+				return errors.New("nope")
+			},
+			Status: StatusFailed,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx   = context.Background()
+				input ReplyInput
+				fn    = func(ctx context.Context, req *Request) (*Response, error) {
+					return &Response{PhysicalResourceId: tc.ID}, nil
+				}
+			)
+
+			handler := New(fn, WithTransport(captureReply(t, &input)), WithPhysicalIDValidator(tc.Validate))
+			if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Status, tc.Status; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if tc.Status == StatusFailed && !strings.Contains(input.Reason, "invalid PhysicalResourceId") {
+				t.Fatalf("got %v; want invalid PhysicalResourceId reason", input.Reason)
+			}
+		})
+	}
+}
+
+func TestPrintableASCII(t *testing.T) {
+	if err := PrintableASCII("my-resource_01/abc~"); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if err := PrintableASCII("abc\tdef"); err == nil {
+		t.Fatalf("got nil; want error")
+	}
+}
+
+func TestFailurePhysicalID(t *testing.T) {
+	testCases := map[string]struct {
+		RequestType        string
+		PhysicalResourceId string
+		Want               string
+	}{
+		"create": {
+			RequestType: RequestTypeCreate,
+			Want:        "failed-create-request-id",
+		},
+		"update": {
+			RequestType:        RequestTypeUpdate,
+			PhysicalResourceId: "abc",
+			Want:               "abc",
+		},
+		"delete": {
+			RequestType:        RequestTypeDelete,
+			PhysicalResourceId: "abc",
+			Want:               "abc",
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx   = context.Background()
+				input ReplyInput
+				fn    = func(ctx context.Context, req *Request) (*Response, error) {
+					return nil, errors.New("boom")
+				}
+			)
+
+			handler := New(fn, WithTransport(captureReply(t, &input)))
+			data := marshalRequest(t, Request{
+				RequestType:        tc.RequestType,
+				RequestId:          "request-id",
+				StackId:            "stack-id",
+				LogicalResourceId:  "Resource",
+				PhysicalResourceId: tc.PhysicalResourceId,
+			})
+			if _, err := handler.Invoke(ctx, data); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Status, StatusFailed; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := input.PhysicalResourceId, tc.Want; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if input.StackId != "stack-id" || input.RequestId != "request-id" || input.LogicalResourceId != "Resource" {
+				t.Fatalf("got %#v; want request ids", input)
+			}
+		})
+	}
+}
+
+func TestDefaultPhysicalResourceID(t *testing.T) {
+	var (
+		stackID  = "arn:aws:cloudformation:us-east-1:123456789012:stack/my-stack/guid"
+		generate = func(req *Request) string { return "generated-" + req.LogicalResourceId }
+		created  = defaultPhysicalID(&Request{StackId: stackID, LogicalResourceId: "Resource"})
+	)
+
+	testCases := map[string]struct {
+		RequestType string
+		RequestID   string
+		Opts        []Option
+		Want        string
+		Status      string
+	}{
+		"create": {
+			RequestType: RequestTypeCreate,
+			Want:        created,
+			Status:      StatusSuccess,
+		},
+		"create custom": {
+			RequestType: RequestTypeCreate,
+			Opts:        []Option{WithPhysicalResourceID(generate)},
+			Want:        "generated-Resource",
+			Status:      StatusSuccess,
+		},
+		"create strict": {
+			RequestType: RequestTypeCreate,
+			Opts:        []Option{WithStrictPhysicalID()},
+			Want:        "failed-create-request-id",
+			Status:      StatusFailed,
+		},
+		"update": {
+			RequestType: RequestTypeUpdate,
+			RequestID:   "existing",
+			Want:        "existing",
+			Status:      StatusSuccess,
+		},
+		"delete": {
+			RequestType: RequestTypeDelete,
+			RequestID:   "existing",
+			Opts:        []Option{WithPhysicalResourceID(generate)},
+			Want:        "existing",
+			Status:      StatusSuccess,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx   = context.Background()
+				input ReplyInput
+				fn    = func(ctx context.Context, req *Request) (*Response, error) {
+					return &Response{}, nil
+				}
+				req = Request{
+					RequestType:        tc.RequestType,
+					StackId:            stackID,
+					LogicalResourceId:  "Resource",
+					RequestId:          "request-id",
+					PhysicalResourceId: tc.RequestID,
+				}
+			)
+
+			opts := append([]Option{WithTransport(captureReply(t, &input))}, tc.Opts...)
+			handler := New(fn, opts...)
+			if _, err := handler.Invoke(ctx, marshalRequest(t, req)); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Status, tc.Status; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := input.PhysicalResourceId, tc.Want; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestDeleteNeverCreated(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		input   ReplyInput
+		deletes int
+		fn      = func(ctx context.Context, req *Request) (*Response, error) {
+			if req.RequestType == RequestTypeDelete {
+				deletes++
+				return nil, errors.New("resource does not exist")
+			}
+			return nil, errors.New("boom")
+		}
+	)
+
+	handler := New(fn, WithTransport(captureReply(t, &input)))
+	create := marshalRequest(t, Request{RequestType: RequestTypeCreate, RequestId: "create-id", LogicalResourceId: "Resource"})
+	if _, err := handler.Invoke(ctx, create); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := input.Status, StatusFailed; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	// rollback of the failed Create
+	physicalID := input.PhysicalResourceId
+	remove := marshalRequest(t, Request{RequestType: RequestTypeDelete, RequestId: "delete-id", LogicalResourceId: "Resource", PhysicalResourceId: physicalID})
+	if _, err := handler.Invoke(ctx, remove); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := input.Status, StatusSuccess; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := input.PhysicalResourceId, physicalID; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := deletes, 0; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	// an ordinary Delete still calls the Func
+	remove = marshalRequest(t, Request{RequestType: RequestTypeDelete, RequestId: "delete-id", LogicalResourceId: "Resource", PhysicalResourceId: "abc"})
+	if _, err := handler.Invoke(ctx, remove); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := deletes, 1; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+func TestFailedCreateRollback(t *testing.T) {
+	testCases := map[string]struct {
+		Opts []Option
+		Data map[string]interface{}
+	}{
+		"verify failed": {
+			Opts: []Option{
+				WithCreateVerify(func(ctx context.Context, req *Request, resp *Response) error {
+					return errors.New("not reachable")
+				}),
+			},
+		},
+		"oversized data": {
+			Opts: []Option{WithMaxDataSize(8)},
+			Data: map[string]interface{}{"Arn": "arn:aws:s3:::blue"},
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx     = context.Background()
+				input   ReplyInput
+				deleted []string
+				fn      = func(ctx context.Context, req *Request) (*Response, error) {
+					if req.RequestType == RequestTypeDelete {
+						deleted = append(deleted, req.PhysicalResourceId)
+						return &Response{}, nil
+					}
+					return &Response{PhysicalResourceId: "i-abc", Data: tc.Data}, nil
+				}
+				opts = append([]Option{WithTransport(captureReply(t, &input))}, tc.Opts...)
+			)
+
+			handler := New(fn, opts...)
+			create := marshalRequest(t, Request{RequestType: RequestTypeCreate, RequestId: "create-id", LogicalResourceId: "Resource"})
+			if _, err := handler.Invoke(ctx, create); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Status, StatusFailed; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := input.PhysicalResourceId, "i-abc"; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+
+			// rollback of the failed Create must remove what the Func created
+			remove := marshalRequest(t, Request{RequestType: RequestTypeDelete, RequestId: "delete-id", LogicalResourceId: "Resource", PhysicalResourceId: input.PhysicalResourceId})
+			if _, err := handler.Invoke(ctx, remove); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := deleted, []string{"i-abc"}; !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestReservedPhysicalID(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		input   ReplyInput
+		deletes int
+		fn      = func(ctx context.Context, req *Request) (*Response, error) {
+			if req.RequestType == RequestTypeDelete {
+				deletes++
+				return &Response{}, nil
+			}
+			return &Response{PhysicalResourceId: "failed-create-mine"}, nil
+		}
+	)
+
+	handler := New(fn, WithTransport(captureReply(t, &input)))
+	create := marshalRequest(t, Request{RequestType: RequestTypeCreate, RequestId: "create-id", LogicalResourceId: "Resource"})
+	if _, err := handler.Invoke(ctx, create); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := input.Status, StatusFailed; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := input.Reason, `handler returned PhysicalResourceId "failed-create-mine"; the prefix failed-create- is reserved`; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	remove := marshalRequest(t, Request{RequestType: RequestTypeDelete, RequestId: "delete-id", LogicalResourceId: "Resource", PhysicalResourceId: input.PhysicalResourceId})
+	if _, err := handler.Invoke(ctx, remove); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := deletes, 1; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		input   ReplyInput
+		buf     = &bytes.Buffer{}
+		deleted []string
+		fn      = func(ctx context.Context, req *Request) (*Response, error) {
+			var props struct{ Name string }
+			if err := req.Decode(&props); err != nil {
+				return nil, err
+			}
+
+			switch req.RequestType {
+			case RequestTypeCreate:
+				return &Response{PhysicalResourceId: props.Name}, nil
+			case RequestTypeUpdate:
+				resp := &Response{PhysicalResourceId: req.PhysicalResourceId}
+				if props.Name != req.PhysicalResourceId {
+					Replace(resp, props.Name) // name is immutable
+				}
+				return resp, nil
+			default:
+				deleted = append(deleted, req.PhysicalResourceId)
+				return &Response{}, nil
+			}
+		}
+		handler = New(fn, WithTransport(captureReply(t, &input)), WithOutput(buf))
+	)
+
+	invoke := func(requestType, physicalID, name string) string {
+		t.Helper()
+		data := marshalRequest(t, Request{
+			RequestType:        requestType,
+			LogicalResourceId:  "Resource",
+			PhysicalResourceId: physicalID,
+			ResourceProperties: json.RawMessage(`{"Name":"` + name + `"}`),
+		})
+		if _, err := handler.Invoke(ctx, data); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := input.Status, StatusSuccess; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		return input.PhysicalResourceId
+	}
+
+	blue := invoke(RequestTypeCreate, "", "blue")
+	if got, want := invoke(RequestTypeUpdate, blue, "blue"), "blue"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if strings.Contains(buf.String(), "replaces") {
+		t.Fatalf("got replacement; want update in place")
+	}
+
+	green := invoke(RequestTypeUpdate, blue, "green")
+	if got, want := green, "green"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := buf.String(), "Resource: Update replaces PhysicalResourceId blue with green"; !strings.Contains(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	// CloudFormation deletes the old resource once the update completes
+	if got, want := invoke(RequestTypeDelete, blue, "blue"), "blue"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := deleted, []string{"blue"}; len(got) != 1 || got[0] != want[0] {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type propertySchema struct {
+	schema *jsonSchema
+	err    error // schema could not be compiled
+}
+
+// validate returns a *ValidationError if the ResourceProperties of req do not
+// conform to the schema.  String scalars are coerced to the types the schema
+// expects, see jsonSchema.coerce.  The ServiceToken, added to every request by
+// CloudFormation, is ignored.
+func (p *propertySchema) validate(req *Request) error {
+	if p.err != nil {
+		return fmt.Errorf("invalid properties schema: %v", p.err)
+	}
+
+	props := map[string]interface{}{}
+	if len(req.ResourceProperties) > 0 {
+		if err := json.Unmarshal(req.ResourceProperties, &props); err != nil {
+			return fmt.Errorf("unable to decode ResourceProperties for %v: %v", req.ResourceType, err)
+		}
+	}
+	delete(props, "ServiceToken")
+
+	v := &ValidationError{
+		Fields: p.schema.validate("ResourceProperties", p.schema.coerce(props)),
+	}
+	return v.Err()
+}
+
+// WithSchema validates the ResourceProperties of Create and Update requests
+// against the JSON Schema, schema, before the Func is called.  Requests that
+// do not conform receive a FAILED reply listing each violation.  As
+// CloudFormation sends every scalar as a string, strings are converted to the
+// integer, number, or boolean the schema expects before validation; the Func
+// still receives the original strings.  Delete
+// requests are not validated so resources created before a schema change can
+// still be deleted.  See jsonschema.go for the supported subset of JSON
+// Schema.
+func WithSchema(schema []byte) Option {
+	return func(o *options) {
+		s := &propertySchema{}
+		s.schema, s.err = compileSchema(schema)
+		o.propertySchema = s
+	}
+}
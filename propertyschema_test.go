@@ -0,0 +1,138 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestWithSchema(t *testing.T) {
+	const schema = `{
+		"type": "object",
+		"properties": {
+			"BucketName": {"type": "string", "minLength": 3},
+			"Versioned":  {"type": "boolean"}
+		},
+		"required": ["BucketName"],
+		"additionalProperties": false
+	}`
+
+	testCases := map[string]struct {
+		Schema      string
+		RequestType string
+		Props       string
+		Status      string
+		Reason      string
+	}{
+		"valid": {
+			Schema:      schema,
+			RequestType: RequestTypeCreate,
+			Props:       `{"ServiceToken":"arn","BucketName":"blue","Versioned":true}`,
+			Status:      StatusSuccess,
+		},
+		"coerced": {
+			Schema:      schema,
+			RequestType: RequestTypeCreate,
+			Props:       `{"BucketName":"blue","Versioned":"true"}`,
+			Status:      StatusSuccess,
+		},
+		"not coercible": {
+			Schema:      schema,
+			RequestType: RequestTypeCreate,
+			Props:       `{"BucketName":"blue","Versioned":"yes"}`,
+			Status:      StatusFailed,
+			Reason:      "validation failed: ResourceProperties.Versioned: must be of type boolean",
+		},
+		"missing required": {
+			Schema:      schema,
+			RequestType: RequestTypeCreate,
+			Props:       `{"ServiceToken":"arn","Versioned":true}`,
+			Status:      StatusFailed,
+			Reason:      "validation failed: ResourceProperties.BucketName: is required",
+		},
+		"several": {
+			Schema:      schema,
+			RequestType: RequestTypeUpdate,
+			Props:       `{"BucketName":"b","Color":"red"}`,
+			Status:      StatusFailed,
+			Reason:      "validation failed: ResourceProperties.BucketName: must be at least 3 characters; ResourceProperties.Color: is not allowed",
+		},
+		"delete": {
+			Schema:      schema,
+			RequestType: RequestTypeDelete,
+			Props:       `{}`,
+			Status:      StatusSuccess,
+		},
+		"invalid schema": {
+			Schema:      `{"type":`,
+			RequestType: RequestTypeCreate,
+			Props:       `{}`,
+			Status:      StatusFailed,
+			Reason:      "invalid properties schema: unable to parse schema: unexpected end of JSON input",
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx   = context.Background()
+				input ReplyInput
+				calls int
+				fn    = func(ctx context.Context, req *Request) (*Response, error) {
+					calls++
+					return &Response{PhysicalResourceId: "abc"}, nil
+				}
+			)
+
+			handler := New(fn, WithTransport(captureReply(t, &input)), WithSchema([]byte(tc.Schema)))
+			data := marshalRequest(t, Request{RequestType: tc.RequestType, PhysicalResourceId: "abc", ResourceProperties: json.RawMessage(tc.Props)})
+			if _, err := handler.Invoke(ctx, data); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Status, tc.Status; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := input.Reason, tc.Reason; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := calls == 1, tc.Status == StatusSuccess; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestPropertySchemaValidationError(t *testing.T) {
+	s := &propertySchema{}
+	s.schema, s.err = compileSchema([]byte(`{"properties": {"Port": {"type": "integer", "maximum": 65535}}}`))
+
+	err := s.validate(&Request{ResourceProperties: json.RawMessage(`{"Port":"70000"}`)})
+	var v *ValidationError
+	if !errors.As(err, &v) {
+		t.Fatalf("got %v; want *ValidationError", err)
+	}
+	want := []FieldError{{Path: "ResourceProperties.Port", Message: "must be at most 65535"}}
+	if got := v.Fields; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	if err := s.validate(&Request{ResourceProperties: json.RawMessage(`{"Port":"8080"}`)}); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+}
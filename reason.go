@@ -0,0 +1,174 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxReasonLength is the longest reason, in bytes, CloudFormation accepts
+const maxReasonLength = 4096
+
+// reasonEllipsis marks a truncated reason
+const reasonEllipsis = "..."
+
+// reNewline matches a line break along with any surrounding whitespace
+var reNewline = regexp.MustCompile(`[ \t]*(\r\n|\r|\n)\s*`)
+
+// normalizeReason trims surrounding whitespace and replaces line breaks with
+// sep so reasons render on a single line in the CloudFormation console
+func normalizeReason(reason, sep string) string {
+	return reNewline.ReplaceAllString(strings.TrimSpace(reason), sep)
+}
+
+// truncateReason limits reason to max bytes, truncating on a rune boundary
+// and appending an ellipsis.  CloudFormation refuses replies with reasons
+// longer than maxReasonLength, leaving the stack to hang until it times out.
+func truncateReason(reason string, max int) string {
+	if len(reason) <= max {
+		return reason
+	}
+
+	suffix := reasonEllipsis
+	if max < len(suffix) {
+		suffix = ""
+	}
+	n := max - len(suffix)
+	for n > 0 && !utf8.RuneStart(reason[n]) {
+		n--
+	}
+	return reason[:n] + suffix
+}
+
+// reason returns the failure reason to report for err.  When the reason
+// differs from the error, the full error is logged.
+func (h *Handler) reason(req *Request, err error) string {
+	var reason string
+	if h.reasonFormatter != nil {
+		reason = h.reasonFormatter(req, err)
+	} else {
+		reason = h.mapReason(err)
+	}
+	reason = normalizeReason(reason, h.reasonNewline)
+
+	if p, ok := err.(panicError); ok {
+		h.logf(LogError, req, "%v: %v panicked - %v\n%s", req.LogicalResourceId, req.RequestType, err, p.stack)
+		if len(p.frames) > 0 && h.reasonFormatter == nil {
+			reason += " at " + strings.Join(p.frames, " < ")
+		}
+	} else if reason != err.Error() {
+		h.logf(LogError, req, "%v: %v error - %v\n", req.LogicalResourceId, req.RequestType, err)
+	}
+	return reason
+}
+
+// errorReason maps errors matching target to reason
+type errorReason struct {
+	target error
+	reason string
+}
+
+// addErrorReason appends the mapping to reasons, replacing any prior reason
+// for target in place
+func addErrorReason(reasons []errorReason, target error, reason string) []errorReason {
+	for i, r := range reasons {
+		if r.target == target {
+			reasons[i].reason = reason
+			return reasons
+		}
+	}
+	return append(reasons, errorReason{target: target, reason: reason})
+}
+
+func (h *Handler) mapReason(err error) string {
+	for _, r := range h.errorReasons {
+		if errors.Is(err, r.target) {
+			return r.reason
+		}
+	}
+	if h.awsErrorReasons {
+		if reason, ok := awsErrorReason(err); ok {
+			return reason
+		}
+	}
+	return err.Error()
+}
+
+// WithErrorReasonMap replaces the failure reason of errors matching, per
+// errors.Is, a key in m with the corresponding value e.g.
+//
+//	WithErrorReasonMap(map[error]string{
+//		context.DeadlineExceeded: "operation timed out; please retry the stack operation",
+//	})
+//
+// Unmatched errors use err.Error().  Keys are tried in the order of their
+// error text; use WithErrorReason when an error may match more than one key.
+func WithErrorReasonMap(m map[error]string) Option {
+	return func(o *options) {
+		targets := make([]error, 0, len(m))
+		for target := range m {
+			targets = append(targets, target)
+		}
+		sort.Slice(targets, func(i, j int) bool {
+			return targets[i].Error() < targets[j].Error()
+		})
+		for _, target := range targets {
+			o.errorReasons = addErrorReason(o.errorReasons, target, m[target])
+		}
+	}
+}
+
+// WithErrorReason replaces the failure reason of errors matching target, per
+// errors.Is, with reason.  Mappings are tried in the order they are
+// registered, so register the more specific errors first.
+func WithErrorReason(target error, reason string) Option {
+	return func(o *options) {
+		o.errorReasons = addErrorReason(o.errorReasons, target, reason)
+	}
+}
+
+// WithReasonNewline replaces line breaks in failure reasons with sep.  By
+// default, line breaks are replaced with a single space.
+func WithReasonNewline(sep string) Option {
+	return func(o *options) {
+		o.reasonNewline = sep
+	}
+}
+
+// WithMaxReasonLength truncates failure reasons to at most n bytes for
+// tooling that handles long reasons poorly.  Values outside (0, 4096], the
+// CloudFormation limit, use the CloudFormation limit.
+func WithMaxReasonLength(n int) Option {
+	return func(o *options) {
+		if n <= 0 || n > maxReasonLength {
+			n = maxReasonLength
+		}
+		o.maxReasonLength = n
+	}
+}
+
+// WithReasonFormatter computes the reason of FAILED replies with format rather
+// than from the error e.g. to keep internal details out of stack events,
+// which are visible to a broad audience.  The full error is still logged.
+// WithErrorReasonMap and WithAWSErrorReasons are not applied when set.
+func WithReasonFormatter(format func(req *Request, err error) string) Option {
+	return func(o *options) {
+		o.reasonFormatter = format
+	}
+}
@@ -0,0 +1,308 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestWithErrorReasonMap(t *testing.T) {
+	const timedOut = "operation timed out; please retry the stack operation"
+
+	testCases := map[string]struct {
+		Err    error
+		Reason string
+	}{
+		"mapped": {
+			Err:    context.DeadlineExceeded,
+			Reason: timedOut,
+		},
+		"wrapped": {
+			Err:    fmt.Errorf("unable to create bucket: %w", context.DeadlineExceeded),
+			Reason: timedOut,
+		},
+		"unmapped": {
+			Err:    errors.New("boom"),
+			Reason: "boom",
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx   = context.Background()
+				input ReplyInput
+				fn    = func(ctx context.Context, req *Request) (*Response, error) {
+					return nil, tc.Err
+				}
+			)
+
+			handler := New(fn,
+				WithTransport(captureReply(t, &input)),
+				WithErrorReasonMap(map[error]string{context.DeadlineExceeded: timedOut}),
+			)
+			if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Reason, tc.Reason; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestWithErrorReason(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		notFound = errors.New("not found")
+		specific = fmt.Errorf("bucket missing: %w", notFound)
+		fn       = func(ctx context.Context, req *Request) (*Response, error) {
+			return nil, fmt.Errorf("unable to create: %w", specific)
+		}
+	)
+
+	for i := 0; i < 10; i++ {
+		var input ReplyInput
+		handler := New(fn,
+			WithTransport(captureReply(t, &input)),
+			WithErrorReason(specific, "bucket does not exist"),
+			WithErrorReason(notFound, "resource does not exist"),
+		)
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := input.Reason, "bucket does not exist"; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	}
+}
+
+func TestNormalizeReason(t *testing.T) {
+	testCases := map[string]struct {
+		Reason string
+		Sep    string
+		Want   string
+	}{
+		"clean": {
+			Reason: "boom",
+			Sep:    " ",
+			Want:   "boom",
+		},
+		"trailing whitespace": {
+			Reason: "  boom \n\n",
+			Sep:    " ",
+			Want:   "boom",
+		},
+		"newlines": {
+			Reason: "AccessDenied: denied\n\tstatus code: 403, request id: abc",
+			Sep:    " ",
+			Want:   "AccessDenied: denied status code: 403, request id: abc",
+		},
+		"windows": {
+			Reason: "line one\r\nline two\rline three",
+			Sep:    " ",
+			Want:   "line one line two line three",
+		},
+		"custom sep": {
+			Reason: "line one\nline two",
+			Sep:    " | ",
+			Want:   "line one | line two",
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			if got, want := normalizeReason(tc.Reason, tc.Sep), tc.Want; got != want {
+				t.Fatalf("got %q; want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestWithReasonNewline(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		input ReplyInput
+		fn    = func(ctx context.Context, req *Request) (*Response, error) {
+			return nil, errors.New("line one\r\nline two\n")
+		}
+	)
+
+	handler := New(fn, WithTransport(captureReply(t, &input)))
+	if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := input.Reason, "line one line two"; got != want {
+		t.Fatalf("got %q; want %q", got, want)
+	}
+
+	handler = New(fn, WithTransport(captureReply(t, &input)), WithReasonNewline("; "))
+	if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := input.Reason, "line one; line two"; got != want {
+		t.Fatalf("got %q; want %q", got, want)
+	}
+}
+
+func TestTruncateReason(t *testing.T) {
+	testCases := map[string]struct {
+		Reason string
+	}{
+		"short": {
+			Reason: "boom",
+		},
+		"ascii": {
+			Reason: strings.Repeat("x", 10*1024),
+		},
+		"multibyte": {
+			Reason: strings.Repeat("日本", 2*1024),
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			got := truncateReason(tc.Reason, maxReasonLength)
+			if len(got) > maxReasonLength {
+				t.Fatalf("got %v; want <= %v", len(got), maxReasonLength)
+			}
+			if !utf8.ValidString(got) {
+				t.Fatalf("got invalid utf8")
+			}
+			if len(tc.Reason) <= maxReasonLength {
+				if got != tc.Reason {
+					t.Fatalf("got %v; want %v", got, tc.Reason)
+				}
+			} else if !strings.HasSuffix(got, reasonEllipsis) {
+				t.Fatalf("got %v; want ellipsis", got[len(got)-10:])
+			}
+		})
+	}
+}
+
+func TestFailureReasonTruncated(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		body []byte
+		fn   = func(ctx context.Context, req *Request) (*Response, error) {
+			return nil, errors.New(strings.Repeat("x", 10*1024))
+		}
+		rt = func(req *http.Request) (*http.Response, error) {
+			data, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			body = data
+			w := httptest.NewRecorder()
+			w.WriteHeader(http.StatusOK)
+			return w.Result(), nil
+		}
+	)
+
+	handler := New(fn, WithTransport(transportFunc(rt)))
+	if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	var input ReplyInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got := len(input.Reason); got > maxReasonLength {
+		t.Fatalf("got %v; want <= %v", got, maxReasonLength)
+	}
+	if got, limit := len(body), maxReasonLength+512; got > limit {
+		t.Fatalf("got %v; want <= %v", got, limit)
+	}
+}
+
+func TestWithMaxReasonLength(t *testing.T) {
+	testCases := map[string]struct {
+		N    int
+		Want string
+	}{
+		"short": {
+			N:    10,
+			Want: "abcdefg...",
+		},
+		"fits": {
+			N:    26,
+			Want: "abcdefghijklmnopqrstuvwxyz",
+		},
+		"tiny": {
+			N:    2,
+			Want: "ab",
+		},
+		"default": {
+			N:    0,
+			Want: "abcdefghijklmnopqrstuvwxyz",
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx   = context.Background()
+				input ReplyInput
+				fn    = func(ctx context.Context, req *Request) (*Response, error) {
+					return nil, errors.New("abcdefghijklmnopqrstuvwxyz")
+				}
+			)
+
+			handler := New(fn, WithTransport(captureReply(t, &input)), WithMaxReasonLength(tc.N))
+			if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Reason, tc.Want; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestWithReasonFormatter(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		input ReplyInput
+		buf   = &bytes.Buffer{}
+		fn    = func(ctx context.Context, req *Request) (*Response, error) {
+			return nil, errors.New("dial tcp 10.0.3.17:5432: connection refused")
+		}
+		redact = func(req *Request, err error) string {
+			return "internal error; correlation id " + req.RequestId
+		}
+	)
+
+	handler := New(fn, WithTransport(captureReply(t, &input)), WithOutput(buf), WithReasonFormatter(redact))
+	if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate, RequestId: "request-id", LogicalResourceId: "Resource"})); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := input.Reason, "internal error; correlation id request-id"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := buf.String(), "Resource: Create error - dial tcp 10.0.3.17:5432: connection refused"; !strings.Contains(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RecursionStore counts invocations per key.  Production deployments should
+// use a store shared across Lambda containers e.g. one backed by DynamoDB.
+type RecursionStore interface {
+	// Increment records an invocation for key and returns the number of
+	// invocations for key, including this one, within the trailing window
+	Increment(ctx context.Context, key string, window time.Duration) (int, error)
+}
+
+// MemoryRecursionStore counts invocations in memory using the wall clock
+type MemoryRecursionStore struct {
+	mutex  sync.Mutex
+	now    func() time.Time
+	events map[string][]time.Time
+}
+
+// NewMemoryRecursionStore returns a new MemoryRecursionStore
+func NewMemoryRecursionStore() *MemoryRecursionStore {
+	return &MemoryRecursionStore{
+		now:    time.Now,
+		events: map[string][]time.Time{},
+	}
+}
+
+// Increment implements RecursionStore
+func (m *MemoryRecursionStore) Increment(ctx context.Context, key string, window time.Duration) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var (
+		now    = m.now()
+		cutoff = now.Add(-window)
+		events []time.Time
+	)
+	for _, t := range m.events[key] {
+		if t.After(cutoff) {
+			events = append(events, t)
+		}
+	}
+	events = append(events, now)
+	m.events[key] = events
+
+	return len(events), nil
+}
+
+type recursionGuard struct {
+	store        RecursionStore
+	maxPerWindow int
+	window       time.Duration
+}
+
+// checkRecursion returns an error if the resource has been invoked more than
+// maxPerWindow times within the window.  Store failures are logged and the
+// invocation allowed.
+func (h *Handler) checkRecursion(ctx context.Context, req *Request) error {
+	g := h.recursionGuard
+	key := req.StackId + "/" + req.LogicalResourceId
+	n, err := g.store.Increment(ctx, key, g.window)
+	if err != nil {
+		h.logf(LogWarn, req, "%v: unable to check recursion guard - %v\n", req.LogicalResourceId, err)
+		return nil
+	}
+	if n > g.maxPerWindow {
+		return fmt.Errorf("recursion guard tripped: %v invoked %v times within %v; at most %v allowed", req.LogicalResourceId, n, g.window, g.maxPerWindow)
+	}
+	return nil
+}
+
+// WithRecursionGuard replies FAILED, without calling the Func, when a
+// resource, identified by stack and logical id, is invoked more than
+// maxPerWindow times within window.  This breaks loops where a Func causes
+// CloudFormation to invoke it again.
+func WithRecursionGuard(store RecursionStore, maxPerWindow int, window time.Duration) Option {
+	return func(o *options) {
+		if store != nil {
+			o.recursionGuard = &recursionGuard{
+				store:        store,
+				maxPerWindow: maxPerWindow,
+				window:       window,
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithRecursionGuard(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		input ReplyInput
+		calls int
+		fn    = func(ctx context.Context, req *Request) (*Response, error) {
+			calls++
+			return &Response{PhysicalResourceId: "abc"}, nil
+		}
+		now   = time.Unix(1550000000, 0)
+		store = NewMemoryRecursionStore()
+	)
+	store.now = func() time.Time { return now }
+
+	handler := New(fn, WithTransport(captureReply(t, &input)), WithRecursionGuard(store, 3, time.Minute))
+	data := marshalRequest(t, Request{RequestType: RequestTypeUpdate, StackId: "stack", LogicalResourceId: "Resource"})
+
+	for i := 0; i < 3; i++ {
+		if _, err := handler.Invoke(ctx, data); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := input.Status, StatusSuccess; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	}
+
+	// fourth invocation within the window trips the guard
+	if _, err := handler.Invoke(ctx, data); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := input.Status, StatusFailed; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if !strings.HasPrefix(input.Reason, "recursion guard tripped") {
+		t.Fatalf("got %v; want recursion guard reason", input.Reason)
+	}
+	if got, want := calls, 3; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	// other resources are unaffected
+	other := marshalRequest(t, Request{RequestType: RequestTypeUpdate, StackId: "stack", LogicalResourceId: "Other"})
+	if _, err := handler.Invoke(ctx, other); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := input.Status, StatusSuccess; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	// once the window passes, invocations are allowed again
+	now = now.Add(2 * time.Minute)
+	if _, err := handler.Invoke(ctx, data); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := input.Status, StatusSuccess; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
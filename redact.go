@@ -0,0 +1,58 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+)
+
+// hashValue returns a short, stable, hash of v suitable for logging
+func hashValue(v interface{}) string {
+	sum := sha256.Sum256([]byte(fmt.Sprint(v)))
+	return fmt.Sprintf("sha256:%x", sum[:6])
+}
+
+// redactData returns data as json with the values of the sensitive keys
+// replaced by their hash
+func redactData(data map[string]interface{}, sensitive map[string]struct{}) string {
+	redacted := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		if _, ok := sensitive[k]; ok {
+			v = hashValue(v)
+		}
+		redacted[k] = v
+	}
+
+	encoded, err := json.Marshal(redacted)
+	if err != nil {
+		return fmt.Sprintf("unable to encode Data: %v", err)
+	}
+	return string(encoded)
+}
+
+// WithLogHashSensitive logs the Data of successful replies with the values of
+// the listed keys replaced by a hash.  The reply itself carries the real values.
+func WithLogHashSensitive(keys ...string) Option {
+	return func(o *options) {
+		if o.sensitiveKeys == nil {
+			o.sensitiveKeys = map[string]struct{}{}
+		}
+		for _, key := range keys {
+			o.sensitiveKeys[key] = struct{}{}
+		}
+	}
+}
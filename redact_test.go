@@ -0,0 +1,67 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestWithLogHashSensitive(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		buf   = bytes.NewBuffer(nil)
+		input ReplyInput
+		fn    = func(ctx context.Context, req *Request) (*Response, error) {
+			return &Response{
+				PhysicalResourceId: "abc",
+				Data: map[string]interface{}{
+					"Username": "admin",
+					"Password": "hunter2",
+				},
+			}, nil
+		}
+	)
+
+	handler := New(fn,
+		WithTransport(captureReply(t, &input)),
+		WithOutput(buf),
+		WithLogHashSensitive("Password"),
+	)
+	if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	output := buf.String()
+	if strings.Contains(output, "hunter2") {
+		t.Fatalf("got %v; want password redacted", output)
+	}
+	if !strings.Contains(output, hashValue("hunter2")) {
+		t.Fatalf("got %v; want password hash", output)
+	}
+	if !strings.Contains(output, "admin") {
+		t.Fatalf("got %v; want username", output)
+	}
+
+	data, ok := input.Data.(map[string]interface{})
+	if !ok {
+		t.Fatalf("got %T; want map", input.Data)
+	}
+	if got, want := data["Password"], "hunter2"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
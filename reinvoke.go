@@ -0,0 +1,95 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrNotReady may be returned, optionally wrapped, by a Func whose resource
+// is still being provisioned.  With WithReinvoke, no reply is sent and the
+// request is rescheduled so the Func can poll again later.  Without it,
+// ErrNotReady is an ordinary error and the handler replies FAILED.
+//
+// The contract for polling is:
+//
+//   - the Func is called again with the same Request, so each call must
+//     pick up where the previous one left off e.g. by looking up the
+//     resource it started creating rather than starting another
+//   - CloudFormation waits at most an hour for a reply, so the Func must
+//     eventually return something other than ErrNotReady; a Func may use
+//     the RequestId to track how long it has been waiting
+//   - Dispatch does not reinvoke; it replies FAILED with ErrNotReady
+var ErrNotReady = errors.New("resource not ready")
+
+// Reinvoker reschedules a request whose Func returned ErrNotReady e.g. by
+// invoking the Lambda asynchronously, after a delay, via a Step Functions
+// wait state or an SQS delay queue.
+type Reinvoker interface {
+	// Reinvoke arranges for req to be processed again.  If Reinvoke returns
+	// an error, the handler replies FAILED.
+	Reinvoke(ctx context.Context, req *Request) error
+}
+
+// ReinvokerFunc provides a func based implementation of Reinvoker
+type ReinvokerFunc func(ctx context.Context, req *Request) error
+
+// Reinvoke implements Reinvoker
+func (fn ReinvokerFunc) Reinvoke(ctx context.Context, req *Request) error {
+	return fn(ctx, req)
+}
+
+// StatusReinvoked is recorded in place of a reply status when the Func was
+// not ready and the request was rescheduled; it is never sent to
+// CloudFormation
+const StatusReinvoked = "REINVOKED"
+
+// reinvokedReplyStatus is reported by the summary line when no reply was sent
+// as the request was rescheduled
+const reinvokedReplyStatus = "reinvoked"
+
+// newReinvokedReply returns the outcome recorded, by metrics, archives, and
+// summary lines, for a rescheduled request
+func newReinvokedReply(req *Request) *ReplyInput {
+	return &ReplyInput{
+		Status:             StatusReinvoked,
+		Reason:             ErrNotReady.Error(),
+		PhysicalResourceId: req.PhysicalResourceId,
+		StackId:            req.StackId,
+		RequestId:          req.RequestId,
+		LogicalResourceId:  req.LogicalResourceId,
+	}
+}
+
+// reinvoke reschedules req via the Reinvoker
+func (h *Handler) reinvoke(ctx context.Context, req *Request) error {
+	if err := h.reinvoker.Reinvoke(ctx, req); err != nil {
+		h.logf(LogError, req, "%v: %v not ready; unable to reinvoke - %v\n", req.LogicalResourceId, req.RequestType, err)
+		return fmt.Errorf("unable to reinvoke: %v", err)
+	}
+	h.logf(LogInfo, req, "%v: %v not ready; reinvoke scheduled\n", req.LogicalResourceId, req.RequestType)
+	return nil
+}
+
+// WithReinvoke defers the reply when the Func returns ErrNotReady and
+// reschedules the request via r instead.  See ErrNotReady for the polling
+// contract.
+func WithReinvoke(r Reinvoker) Option {
+	return func(o *options) {
+		o.reinvoker = r
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWithReinvoke(t *testing.T) {
+	var (
+		ctx = context.Background()
+		fn  = func(ctx context.Context, req *Request) (*Response, error) {
+			return nil, fmt.Errorf("waiting on provisioner: %w", ErrNotReady)
+		}
+	)
+
+	t.Run("no reply", func(t *testing.T) {
+		var (
+			replies   int
+			reinvoked []string
+			transport = transportFunc(func(req *http.Request) (*http.Response, error) {
+				replies++
+				return nil, errors.New("unexpected reply")
+			})
+			reinvoker = ReinvokerFunc(func(ctx context.Context, req *Request) error {
+				reinvoked = append(reinvoked, req.RequestId)
+				return nil
+			})
+			handler = New(fn, WithTransport(transport), WithReinvoke(reinvoker))
+		)
+
+		result, err := handler.Process(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate, RequestId: "abc"}))
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if !result.Reinvoked {
+			t.Fatalf("got false; want true")
+		}
+		if got, want := replies, 0; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := fmt.Sprint(reinvoked), "[abc]"; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("bookkeeping", func(t *testing.T) {
+		var (
+			buf       = &bytes.Buffer{}
+			reinvoker = ReinvokerFunc(func(ctx context.Context, req *Request) error { return nil })
+			handler   = New(fn,
+				WithTransport(okTransport{}),
+				WithReinvoke(reinvoker),
+				WithOutput(buf),
+				WithSummaryLine(),
+				WithRetainReply(true),
+				WithMetricsSnapshot(),
+			)
+		)
+
+		result, err := handler.Process(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate, LogicalResourceId: "Resource"}))
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := result.Status, StatusReinvoked; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got := buf.String(); strings.Contains(got, "[ERROR]") || strings.Contains(got, "failed") {
+			t.Fatalf("got %v; want no failure logged", got)
+		}
+		if got, want := buf.String(), "Resource: Create not ready; reinvoke scheduled"; !strings.Contains(got, want) {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := buf.String(), `"event":"summary"`; !strings.Contains(got, want) {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := handler.LastReply().Status, StatusReinvoked; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := string(handler.MetricsSnapshot()), `"REINVOKED":1`; !strings.Contains(got, want) {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("reinvoke failed", func(t *testing.T) {
+		var (
+			input     ReplyInput
+			reinvoker = ReinvokerFunc(func(ctx context.Context, req *Request) error {
+				return errors.New("throttled")
+			})
+			handler = New(fn, WithTransport(captureReply(t, &input)), WithReinvoke(reinvoker))
+		)
+
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := input.Status, StatusFailed; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := input.Reason, "unable to reinvoke: throttled"; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("without reinvoke", func(t *testing.T) {
+		var (
+			input   ReplyInput
+			handler = New(fn, WithTransport(captureReply(t, &input)))
+		)
+
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := input.Status, StatusFailed; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+}
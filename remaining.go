@@ -0,0 +1,46 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// errInsufficientTime is returned when too little time remains to call the Func
+var errInsufficientTime = errors.New("insufficient time remaining to execute")
+
+// remainingTime returns the time until the ctx deadline; ok is false if ctx
+// has no deadline
+func (h *Handler) remainingTime(ctx context.Context) (remaining time.Duration, ok bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return deadline.Sub(h.clock.Now()), true
+}
+
+// WithMinRemainingTime replies FAILED, without calling the Func, when less
+// than d remains before the Lambda deadline at entry.  CloudFormation does
+// not retry a FAILED reply; the stack operation fails, and typically rolls
+// back, rather than the Func doing half the work before being killed and
+// leaving the stack waiting for a reply that never arrives.  Invocations
+// whose context has no deadline are unaffected.
+func WithMinRemainingTime(d time.Duration) Option {
+	return func(o *options) {
+		o.minRemainingTime = d
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWithMinRemainingTime(t *testing.T) {
+	var (
+		now = time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+		fn  = func(ctx context.Context, req *Request) (*Response, error) {
+			return &Response{PhysicalResourceId: "abc"}, nil
+		}
+	)
+
+	testCases := map[string]struct {
+		Remaining time.Duration
+		Status    string
+		Reason    string
+	}{
+		"sufficient": {
+			Remaining: time.Minute,
+			Status:    StatusSuccess,
+		},
+		"insufficient": {
+			Remaining: 500 * time.Millisecond,
+			Status:    StatusFailed,
+			Reason:    "insufficient time remaining to execute",
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				input ReplyInput
+				clk   = &fakeClock{now: now}
+				ctx   = deadlineContext{Context: context.Background(), deadline: now.Add(tc.Remaining)}
+			)
+
+			handler := New(fn, WithTransport(captureReply(t, &input)), WithMinRemainingTime(2*time.Second), withClock(clk))
+			if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Status, tc.Status; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := input.Reason, tc.Reason; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+
+	t.Run("no deadline", func(t *testing.T) {
+		var input ReplyInput
+		handler := New(fn, WithTransport(captureReply(t, &input)), WithMinRemainingTime(time.Hour))
+		if _, err := handler.Invoke(context.Background(), marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := input.Status, StatusSuccess; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+}
+
+// deadlineContext reports a deadline relative to a fake clock while leaving
+// the underlying context live
+type deadlineContext struct {
+	context.Context
+	deadline time.Time
+}
+
+func (d deadlineContext) Deadline() (time.Time, bool) {
+	return d.deadline, true
+}
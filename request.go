@@ -0,0 +1,81 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Decode unmarshals the ResourceProperties into v.  If the request has no
+// ResourceProperties, v is left unchanged.
+//
+//	var props struct {
+//		BucketName string
+//	}
+//	if err := req.Decode(&props); err != nil {
+//		return nil, err
+//	}
+func (r *Request) Decode(v interface{}) error {
+	if len(r.ResourceProperties) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(r.ResourceProperties, v); err != nil {
+		return fmt.Errorf("unable to decode ResourceProperties for %v: %w", r.ResourceType, err)
+	}
+	return nil
+}
+
+// DecodeOld unmarshals the OldResourceProperties into v.  OldResourceProperties
+// are only sent with Update requests; DecodeOld returns an error if they are
+// absent.
+func (r *Request) DecodeOld(v interface{}) error {
+	if len(r.OldResourceProperties) == 0 || string(r.OldResourceProperties) == "null" {
+		return fmt.Errorf("OldResourceProperties for %v absent", r.ResourceType)
+	}
+	if err := json.Unmarshal(r.OldResourceProperties, v); err != nil {
+		return fmt.Errorf("unable to decode OldResourceProperties for %v: %w", r.ResourceType, err)
+	}
+	return nil
+}
+
+// Changed returns true if field differs between the ResourceProperties and
+// OldResourceProperties of an Update, including when the field was added or
+// removed.  Handlers use it to detect changes to properties that may only be
+// set on Create and so require a replacement, signaled by returning a new
+// PhysicalResourceId e.g.
+//
+//	if changed, err := req.Changed("BucketName"); err != nil {
+//		return nil, err
+//	} else if changed {
+//		return create(ctx, req)
+//	}
+func (r *Request) Changed(field string) (bool, error) {
+	var props, oldProps map[string]interface{}
+	if err := r.Decode(&props); err != nil {
+		return false, err
+	}
+	if err := r.DecodeOld(&oldProps); err != nil {
+		return false, err
+	}
+
+	v, ok := props[field]
+	old, oldOk := oldProps[field]
+	if ok != oldOk {
+		return true, nil
+	}
+	return !reflect.DeepEqual(v, old), nil
+}
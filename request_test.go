@@ -0,0 +1,167 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRequest_Decode(t *testing.T) {
+	type props struct {
+		BucketName string
+		Port       int
+	}
+
+	testCases := map[string]struct {
+		Properties string
+		Want       props
+		Err        string
+	}{
+		"ok": {
+			Properties: `{"BucketName":"blue","Port":80}`,
+			Want:       props{BucketName: "blue", Port: 80},
+		},
+		"empty": {
+			Want: props{},
+		},
+		"malformed": {
+			Properties: `{"Port":"eighty"}`,
+			Err:        "unable to decode ResourceProperties for Custom::Bucket",
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			req := Request{ResourceType: "Custom::Bucket"}
+			if tc.Properties != "" {
+				req.ResourceProperties = json.RawMessage(tc.Properties)
+			}
+
+			var got props
+			err := req.Decode(&got)
+			if tc.Err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tc.Err) {
+					t.Fatalf("got %v; want %v", err, tc.Err)
+				}
+				var jsonErr *json.UnmarshalTypeError
+				if !errors.As(err, &jsonErr) {
+					t.Fatalf("got %T; want wrapped *json.UnmarshalTypeError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got != tc.Want {
+				t.Fatalf("got %v; want %v", got, tc.Want)
+			}
+		})
+	}
+}
+
+func TestRequest_DecodeOld(t *testing.T) {
+	var props struct {
+		BucketName string
+	}
+
+	req := Request{ResourceType: "Custom::Bucket", OldResourceProperties: json.RawMessage(`{"BucketName":"blue"}`)}
+	if err := req.DecodeOld(&props); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := props.BucketName, "blue"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	req = Request{ResourceType: "Custom::Bucket"}
+	if err := req.DecodeOld(&props); err == nil || err.Error() != "OldResourceProperties for Custom::Bucket absent" {
+		t.Fatalf("got %v; want absent error", err)
+	}
+
+	req = Request{ResourceType: "Custom::Bucket", OldResourceProperties: json.RawMessage(`[]`)}
+	if err := req.DecodeOld(&props); err == nil || !strings.HasPrefix(err.Error(), "unable to decode OldResourceProperties for Custom::Bucket") {
+		t.Fatalf("got %v; want decode error", err)
+	}
+}
+
+func TestRequest_Changed(t *testing.T) {
+	testCases := map[string]struct {
+		Props    string
+		OldProps string
+		Want     bool
+		Err      bool
+	}{
+		"unchanged": {
+			Props:    `{"Name":"a","Tags":{"env":"dev"}}`,
+			OldProps: `{"Tags":{"env":"dev"},"Name":"a"}`,
+		},
+		"modified": {
+			Props:    `{"Name":"b"}`,
+			OldProps: `{"Name":"a"}`,
+			Want:     true,
+		},
+		"modified nested": {
+			Props:    `{"Name":{"First":"b"}}`,
+			OldProps: `{"Name":{"First":"a"}}`,
+			Want:     true,
+		},
+		"added": {
+			Props:    `{"Name":"a"}`,
+			OldProps: `{}`,
+			Want:     true,
+		},
+		"removed": {
+			Props:    `{}`,
+			OldProps: `{"Name":"a"}`,
+			Want:     true,
+		},
+		"absent from both": {
+			Props:    `{"Other":"a"}`,
+			OldProps: `{"Other":"b"}`,
+		},
+		"no old properties": {
+			Props: `{"Name":"a"}`,
+			Err:   true,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			req := Request{
+				ResourceType:       "Custom::Widget",
+				ResourceProperties: json.RawMessage(tc.Props),
+			}
+			if tc.OldProps != "" {
+				req.OldResourceProperties = json.RawMessage(tc.OldProps)
+			}
+
+			got, err := req.Changed("Name")
+			if tc.Err {
+				if err == nil {
+					t.Fatalf("got nil; want err")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if want := tc.Want; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Responder allows the Func to take full control of the reply sent to the
+// ResponseURL.  Most handlers should return a plain *Response instead.  The
+// reply is subject to the same checks as a Response e.g. WithMaxDataSize.
+type Responder interface {
+	// BuildReply returns the reply to send for the request.  An error, or a
+	// nil reply, results in a FAILED reply.
+	BuildReply(req *Request) (*ReplyInput, error)
+}
+
+// checkReply applies the checks made of a Response to a reply built by a
+// Responder.  A blank PhysicalResourceId is filled in, the Data of a SUCCESS
+// reply is validated just as the Data of a Response would be, and the Reason
+// is truncated.
+func (h *Handler) checkReply(req *Request, input *ReplyInput) error {
+	if input == nil {
+		return fmt.Errorf("responder returned a nil reply without an error")
+	}
+	if input.Status != StatusSuccess && input.Status != StatusFailed {
+		return fmt.Errorf("responder returned Status %q; expected %v or %v", input.Status, StatusSuccess, StatusFailed)
+	}
+
+	resp := &Response{PhysicalResourceId: input.PhysicalResourceId, NoEcho: input.NoEcho}
+	switch data := input.Data.(type) {
+	case nil:
+	case map[string]interface{}:
+		resp.Data = data
+	case json.RawMessage:
+		resp.RawData = data
+	default:
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("unable to encode Data: %v", err)
+		}
+		resp.RawData = raw
+	}
+
+	h.fillPhysicalID(req, resp)
+	if input.Status == StatusSuccess {
+		if err := h.validateResponse(req, resp); err != nil {
+			return err
+		}
+	}
+
+	input.PhysicalResourceId = resp.PhysicalResourceId
+	input.Reason = truncateReason(normalizeReason(input.Reason, h.reasonNewline), h.maxReasonLength)
+	return nil
+}
+
+// ResponderFunc allows a func to be used as a Responder
+type ResponderFunc func(req *Request) (*ReplyInput, error)
+
+// BuildReply implements Responder
+func (fn ResponderFunc) BuildReply(req *Request) (*ReplyInput, error) {
+	return fn(req)
+}
+
+// Respond returns a *Response whose reply is built by the Responder rather
+// than from the Response fields.
+//
+//	fn := func(ctx context.Context, req *Request) (*Response, error) {
+//		return Respond(myResponder), nil
+//	}
+func Respond(responder Responder) *Response {
+	return &Response{
+		responder: responder,
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRespond(t *testing.T) {
+	t.Run("response", func(t *testing.T) {
+		var (
+			ctx   = context.Background()
+			input ReplyInput
+			fn    = func(ctx context.Context, req *Request) (*Response, error) {
+				return &Response{PhysicalResourceId: "abc"}, nil
+			}
+		)
+
+		handler := New(fn, WithTransport(captureReply(t, &input)))
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := input.Status, StatusSuccess; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := input.PhysicalResourceId, "abc"; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("responder", func(t *testing.T) {
+		var (
+			ctx       = context.Background()
+			input     ReplyInput
+			responder = func(req *Request) (*ReplyInput, error) {
+				return &ReplyInput{
+					Status:             StatusSuccess,
+					Reason:             "custom",
+					PhysicalResourceId: "xyz",
+					RequestId:          req.RequestId,
+				}, nil
+			}
+			fn = func(ctx context.Context, req *Request) (*Response, error) {
+				return Respond(ResponderFunc(responder)), nil
+			}
+		)
+
+		handler := New(fn, WithTransport(captureReply(t, &input)))
+		data := marshalRequest(t, Request{RequestType: RequestTypeCreate, RequestId: "req"})
+		if _, err := handler.Invoke(ctx, data); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := input.Reason, "custom"; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := input.PhysicalResourceId, "xyz"; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := input.RequestId, "req"; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("responder err", func(t *testing.T) {
+		var (
+			ctx       = context.Background()
+			input     ReplyInput
+			responder = func(req *Request) (*ReplyInput, error) {
+				return nil, errors.New("boom")
+			}
+			fn = func(ctx context.Context, req *Request) (*Response, error) {
+				return Respond(ResponderFunc(responder)), nil
+			}
+		)
+
+		handler := New(fn, WithTransport(captureReply(t, &input)))
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := input.Status, StatusFailed; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := input.Reason, "boom"; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+}
+
+func TestCheckReply(t *testing.T) {
+	testCases := map[string]struct {
+		Reply  *ReplyInput
+		Opts   []Option
+		Status string
+		ID     string
+		Reason string
+	}{
+		"nil reply": {
+			Status: StatusFailed,
+			Reason: "responder returned a nil reply without an error",
+		},
+		"unknown status": {
+			Reply:  &ReplyInput{Status: "OK", PhysicalResourceId: "abc"},
+			Status: StatusFailed,
+			Reason: `responder returned Status "OK"; expected SUCCESS or FAILED`,
+		},
+		"default id": {
+			Reply:  &ReplyInput{Status: StatusSuccess},
+			Status: StatusSuccess,
+			ID:     "Resource-5d45a50b940e",
+		},
+		"data validated": {
+			Reply:  &ReplyInput{Status: StatusSuccess, PhysicalResourceId: "abc", Data: map[string]interface{}{"a": "1", "b": "2"}},
+			Opts:   []Option{WithMaxDataAttributes(1)},
+			Status: StatusFailed,
+			Reason: "handler returned 2 Data attributes; at most 1 are allowed",
+		},
+		"reason truncated": {
+			Reply:  &ReplyInput{Status: StatusFailed, PhysicalResourceId: "abc", Reason: "0123456789"},
+			Opts:   []Option{WithMaxReasonLength(8)},
+			Status: StatusFailed,
+			ID:     "abc",
+			Reason: "01234...",
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx   = context.Background()
+				input ReplyInput
+				fn    = func(ctx context.Context, req *Request) (*Response, error) {
+					return Respond(ResponderFunc(func(req *Request) (*ReplyInput, error) {
+						return tc.Reply, nil
+					})), nil
+				}
+				opts = append([]Option{WithTransport(captureReply(t, &input))}, tc.Opts...)
+			)
+
+			handler := New(fn, opts...)
+			req := Request{RequestType: RequestTypeCreate, StackId: "stack", LogicalResourceId: "Resource"}
+			if _, err := handler.Invoke(ctx, marshalRequest(t, req)); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Status, tc.Status; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := input.Reason, tc.Reason; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if tc.ID != "" {
+				if got, want := input.PhysicalResourceId, tc.ID; got != want {
+					t.Fatalf("got %v; want %v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckResponse(t *testing.T) {
+	responder := ResponderFunc(func(req *Request) (*ReplyInput, error) {
+		return &ReplyInput{Status: StatusSuccess, PhysicalResourceId: "abc"}, nil
+	})
+	withFields := func(fn func(r *Response)) *Response {
+		resp := Respond(responder)
+		fn(resp)
+		return resp
+	}
+
+	testCases := map[string]struct {
+		Response *Response
+		Reason   string
+	}{
+		"nil": {
+			Response: nil,
+			Reason:   "handler returned a nil Response without an error",
+		},
+		"responder with physical id": {
+			Response: withFields(func(r *Response) { r.PhysicalResourceId = "abc" }),
+			Reason:   "handler returned a Response built by Respond that also sets PhysicalResourceId; set them on the ReplyInput instead",
+		},
+		"responder with data and reason": {
+			Response: withFields(func(r *Response) {
+				r.Data = map[string]interface{}{"Arn": "arn"}
+				r.Reason = "note"
+			}),
+			Reason: "handler returned a Response built by Respond that also sets Data, Reason; set them on the ReplyInput instead",
+		},
+		"responder with no echo": {
+			Response: withFields(func(r *Response) { r.NoEcho = true }),
+			Reason:   "handler returned a Response built by Respond that also sets NoEcho; set them on the ReplyInput instead",
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx   = context.Background()
+				input ReplyInput
+				fn    = func(ctx context.Context, req *Request) (*Response, error) {
+					return tc.Response, nil
+				}
+			)
+
+			handler := New(fn, WithTransport(captureReply(t, &input)))
+			if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Status, StatusFailed; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := input.Reason, tc.Reason; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"sync"
+)
+
+// lastReply holds the most recent reply for LastReply
+type lastReply struct {
+	mutex sync.Mutex
+	input *ReplyInput
+}
+
+func (l *lastReply) store(input *ReplyInput) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.input = input
+}
+
+func (l *lastReply) load() *ReplyInput {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.input == nil {
+		return nil
+	}
+	input := *l.input
+	return &input
+}
+
+// LastReply returns a copy of the most recent reply sent, or attempted, by
+// Invoke or Process so test drivers can inspect it without a custom
+// transport.  Returns nil until a reply has been sent or unless
+// WithRetainReply was specified.  With concurrent invocations, the reply
+// returned is that of whichever completed last.
+func (h *Handler) LastReply() *ReplyInput {
+	if h.lastReply == nil {
+		return nil
+	}
+	return h.lastReply.load()
+}
+
+// WithRetainReply retains the most recent reply for LastReply.  Off by
+// default as the reply may include sensitive Data.
+func WithRetainReply(enabled bool) Option {
+	return func(o *options) {
+		o.retainReply = enabled
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestWithRetainReply(t *testing.T) {
+	var (
+		ctx = context.Background()
+		fn  = func(ctx context.Context, req *Request) (*Response, error) {
+			return &Response{PhysicalResourceId: req.LogicalResourceId}, nil
+		}
+	)
+
+	t.Run("retained", func(t *testing.T) {
+		handler := New(fn, WithTransport(okTransport{}), WithRetainReply(true))
+		if got := handler.LastReply(); got != nil {
+			t.Fatalf("got %v; want nil", got)
+		}
+
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate, LogicalResourceId: "Bucket"})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+
+		reply := handler.LastReply()
+		if reply == nil {
+			t.Fatalf("got nil; want reply")
+		}
+		if got, want := reply.Status, StatusSuccess; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := reply.PhysicalResourceId, "Bucket"; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("off by default", func(t *testing.T) {
+		handler := New(fn, WithTransport(okTransport{}))
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got := handler.LastReply(); got != nil {
+			t.Fatalf("got %v; want nil", got)
+		}
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		var (
+			wg      sync.WaitGroup
+			handler = New(fn, WithTransport(okTransport{}), WithRetainReply(true))
+		)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				req := Request{RequestType: RequestTypeCreate, LogicalResourceId: fmt.Sprintf("Bucket%v", i)}
+				if _, err := handler.Invoke(ctx, marshalRequest(t, req)); err != nil {
+					t.Errorf("got %v; want nil", err)
+				}
+				handler.LastReply()
+			}(i)
+		}
+		wg.Wait()
+
+		if got := handler.LastReply(); got == nil {
+			t.Fatalf("got nil; want reply")
+		}
+	})
+}
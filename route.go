@@ -0,0 +1,81 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+type routeKey struct{}
+
+// routeTrace records the branches resolved while routing a request
+type routeTrace struct {
+	mutex    sync.Mutex
+	branches []string
+}
+
+func (r *routeTrace) add(branch string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, b := range r.branches {
+		if b == branch {
+			return
+		}
+	}
+	r.branches = append(r.branches, branch)
+}
+
+func (r *routeTrace) String() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return strings.Join(r.branches, " > ")
+}
+
+// TraceRoute records the branch resolved by a router, e.g. the name of the
+// Func selected for the request, so it appears in the trace written by
+// WithRouteTracing.  TraceRoute is a no-op unless tracing is enabled.
+func TraceRoute(ctx context.Context, branch string) {
+	if r, ok := ctx.Value(routeKey{}).(*routeTrace); ok {
+		r.add(branch)
+	}
+}
+
+// funcName returns the name of the function fn
+func funcName(fn interface{}) string {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return ""
+	}
+	if f := runtime.FuncForPC(v.Pointer()); f != nil {
+		return f.Name()
+	}
+	return ""
+}
+
+// WithRouteTracing logs, for each request, the resource type, request type,
+// and the branch that executed.  The branch is the chain of routes recorded
+// via TraceRoute e.g. by TypedUpdate or StatefulHandler, or the name of the
+// Func when nothing was recorded.
+func WithRouteTracing() Option {
+	return func(o *options) {
+		o.routeTracing = true
+	}
+}
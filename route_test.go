@@ -0,0 +1,131 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func createBranch(ctx context.Context, req *Request) (*Response, error) {
+	return &Response{PhysicalResourceId: "abc"}, nil
+}
+
+func deleteBranch(ctx context.Context, req *Request) (*Response, error) {
+	return &Response{PhysicalResourceId: req.PhysicalResourceId}, nil
+}
+
+func typedBranch(ctx context.Context, req *Request, props, oldProps interface{}) (*Response, error) {
+	return &Response{PhysicalResourceId: "abc"}, nil
+}
+
+func statefulBranch(ctx context.Context, req *Request, state *struct{}) (bool, *Response, error) {
+	return true, &Response{PhysicalResourceId: "abc"}, nil
+}
+
+func router(ctx context.Context, req *Request) (*Response, error) {
+	if req.RequestType == RequestTypeDelete {
+		TraceRoute(ctx, "router.delete")
+		return deleteBranch(ctx, req)
+	}
+	TraceRoute(ctx, "router.create")
+	return createBranch(ctx, req)
+}
+
+func TestWithRouteTracing(t *testing.T) {
+	typed := TypedUpdate{
+		NewProps: func() interface{} { return &struct{}{} },
+		Fn:       typedBranch,
+	}
+	stateful := StatefulHandler[struct{}]{
+		Fn: statefulBranch,
+	}
+
+	testCases := map[string]struct {
+		Fn          Func
+		RequestType string
+		Branch      string
+	}{
+		"func": {
+			Fn:          createBranch,
+			RequestType: RequestTypeCreate,
+			Branch:      "branch=github.com/savaki/customresource.createBranch",
+		},
+		"router create": {
+			Fn:          router,
+			RequestType: RequestTypeCreate,
+			Branch:      "branch=router.create\n",
+		},
+		"router delete": {
+			Fn:          router,
+			RequestType: RequestTypeDelete,
+			Branch:      "branch=router.delete\n",
+		},
+		"typed update": {
+			Fn:          typed.Func(),
+			RequestType: RequestTypeUpdate,
+			Branch:      "branch=TypedUpdate(github.com/savaki/customresource.typedBranch)",
+		},
+		"stateful": {
+			Fn:          stateful.Func(),
+			RequestType: RequestTypeUpdate,
+			Branch:      "branch=StatefulHandler(github.com/savaki/customresource.statefulBranch)",
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx   = context.Background()
+				buf   = bytes.NewBuffer(nil)
+				input ReplyInput
+			)
+
+			handler := New(tc.Fn, WithTransport(captureReply(t, &input)), WithOutput(buf), WithRouteTracing())
+			data := marshalRequest(t, Request{
+				RequestType:        tc.RequestType,
+				ResourceType:       "Custom::Widget",
+				PhysicalResourceId: "abc",
+			})
+			if _, err := handler.Invoke(ctx, data); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+
+			output := buf.String()
+			if want := "route resourceType=Custom::Widget requestType=" + tc.RequestType; !strings.Contains(output, want) {
+				t.Fatalf("got %v; want %v", output, want)
+			}
+			if !strings.Contains(output, tc.Branch) {
+				t.Fatalf("got %v; want %v", output, tc.Branch)
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		var (
+			buf   = bytes.NewBuffer(nil)
+			input ReplyInput
+		)
+		handler := New(router, WithTransport(captureReply(t, &input)), WithOutput(buf))
+		if _, err := handler.Invoke(context.Background(), marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if strings.Contains(buf.String(), "route") {
+			t.Fatalf("got %v; want no route", buf.String())
+		}
+	})
+}
@@ -0,0 +1,126 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type schemaBase struct {
+	Name string `json:"name" description:"name of the widget"`
+}
+
+type schemaProps struct {
+	schemaBase
+	Size     int               `json:"size,omitempty"`
+	Ratio    float64           `json:"ratio"`
+	Enabled  *bool             `json:"enabled"`
+	Tags     []string          `json:"tags,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Created  time.Time         `json:"created"`
+	Parent   *schemaProps      `json:"parent,omitempty"`
+	Ignored  string            `json:"-"`
+	Untagged string
+	internal string
+}
+
+type schemaData struct {
+	Arn string
+}
+
+func TestSchemaFor(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		data, err := SchemaFor(schemaProps{}, &schemaData{})
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+
+		var got map[string]interface{}
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+
+		var want map[string]interface{}
+		if err := json.Unmarshal([]byte(`{
+			"$schema": "http://json-schema.org/draft-07/schema#",
+			"type": "object",
+			"properties": {
+				"ResourceProperties": {
+					"type": "object",
+					"properties": {
+						"name":     {"type": "string", "description": "name of the widget"},
+						"size":     {"type": "integer"},
+						"ratio":    {"type": "number"},
+						"enabled":  {"type": "boolean"},
+						"tags":     {"type": "array", "items": {"type": "string"}},
+						"labels":   {"type": "object", "additionalProperties": {"type": "string"}},
+						"created":  {"type": "string", "format": "date-time"},
+						"parent":   {"type": "object"},
+						"Untagged": {"type": "string"}
+					},
+					"required": ["name", "ratio", "created", "Untagged"]
+				},
+				"Data": {
+					"type": "object",
+					"properties": {
+						"Arn": {"type": "string"}
+					},
+					"required": ["Arn"]
+				}
+			}
+		}`), &want); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("got %s; want %v", data, want)
+		}
+	})
+
+	t.Run("validates", func(t *testing.T) {
+		data, err := SchemaFor(schemaData{}, nil)
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+
+		var doc struct {
+			Properties struct {
+				ResourceProperties json.RawMessage
+			} `json:"properties"`
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		schema, err := compileSchema(doc.Properties.ResourceProperties)
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got := schema.validate("ResourceProperties", map[string]interface{}{"Arn": "arn:aws:s3:::bucket"}); len(got) != 0 {
+			t.Fatalf("got %v; want none", got)
+		}
+		if got := schema.validate("ResourceProperties", map[string]interface{}{}); len(got) != 1 {
+			t.Fatalf("got %v; want 1 violation", got)
+		}
+	})
+
+	t.Run("not a struct", func(t *testing.T) {
+		if _, err := SchemaFor("props", nil); err == nil {
+			t.Fatalf("got nil; want err")
+		}
+	})
+}
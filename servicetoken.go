@@ -0,0 +1,71 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+// ServiceToken returns the ServiceToken, the arn of the function invoked,
+// that CloudFormation passes in ResourceProperties.  An empty string is
+// returned if the ServiceToken is absent.
+func ServiceToken(req *Request) string {
+	var props struct {
+		ServiceToken string
+	}
+	if len(req.ResourceProperties) == 0 {
+		return ""
+	}
+	if err := json.Unmarshal(req.ResourceProperties, &props); err != nil {
+		return ""
+	}
+	return props.ServiceToken
+}
+
+// sameFunction returns true if both arns refer to the same function; an
+// unqualified arn matches any version or alias of that function
+func sameFunction(a, b string) bool {
+	if a == b {
+		return true
+	}
+	return strings.HasPrefix(a, b+":") || strings.HasPrefix(b, a+":")
+}
+
+func validateServiceToken(ctx context.Context, req *Request) error {
+	lc, ok := lambdacontext.FromContext(ctx)
+	if !ok || lc.InvokedFunctionArn == "" {
+		return nil // nothing to compare against e.g. when running locally
+	}
+
+	serviceToken := ServiceToken(req)
+	if !sameFunction(serviceToken, lc.InvokedFunctionArn) {
+		return fmt.Errorf("ServiceToken, %v, does not match function, %v", serviceToken, lc.InvokedFunctionArn)
+	}
+
+	return nil
+}
+
+// WithValidateServiceToken replies FAILED if the ServiceToken in
+// ResourceProperties does not refer to this function
+func WithValidateServiceToken() Option {
+	return func(o *options) {
+		o.validateServiceToken = true
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+func TestServiceToken(t *testing.T) {
+	testCases := map[string]struct {
+		Props json.RawMessage
+		Want  string
+	}{
+		"present": {
+			Props: json.RawMessage(`{"ServiceToken":"arn:aws:lambda:us-east-1:123456789012:function:fn"}`),
+			Want:  "arn:aws:lambda:us-east-1:123456789012:function:fn",
+		},
+		"absent": {
+			Props: json.RawMessage(`{"Name":"blah"}`),
+		},
+		"empty": {},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			if got, want := ServiceToken(&Request{ResourceProperties: tc.Props}), tc.Want; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestWithValidateServiceToken(t *testing.T) {
+	const arn = "arn:aws:lambda:us-east-1:123456789012:function:fn"
+
+	testCases := map[string]struct {
+		ServiceToken string
+		Status       string
+	}{
+		"match": {
+			ServiceToken: arn,
+			Status:       StatusSuccess,
+		},
+		"qualified": {
+			ServiceToken: arn + ":live",
+			Status:       StatusSuccess,
+		},
+		"mismatch": {
+			ServiceToken: "arn:aws:lambda:us-east-1:123456789012:function:other",
+			Status:       StatusFailed,
+		},
+		"missing": {
+			Status: StatusFailed,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx   = lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{InvokedFunctionArn: arn})
+				input ReplyInput
+				fn    = func(ctx context.Context, req *Request) (*Response, error) {
+					return &Response{PhysicalResourceId: "abc"}, nil
+				}
+			)
+
+			props, _ := json.Marshal(map[string]string{"ServiceToken": tc.ServiceToken})
+			handler := New(fn, WithTransport(captureReply(t, &input)), WithValidateServiceToken())
+			data := marshalRequest(t, Request{RequestType: RequestTypeCreate, ResourceProperties: props})
+			if _, err := handler.Invoke(ctx, data); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Status, tc.Status; got != want {
+				t.Fatalf("got %v; want %v: %v", got, want, input.Reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// SetData sets resp.Data from v, typically a struct whose json tags name the
+// attributes retrievable via !GetAtt e.g.
+//
+//	var out struct {
+//		Arn  string `json:"Arn"`
+//		Host string `json:"Endpoint.Address"`
+//	}
+//	if err := customresource.SetData(resp, out); err != nil {
+//		return nil, err
+//	}
+//
+// As CloudFormation only supports string attribute values, a
+// *ValidationError listing every non-string value is returned, and resp is
+// left unchanged, if any value, including those within nested objects, is
+// not a string.
+func SetData(resp *Response, v interface{}) error {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("unable to encode Data: %v", err)
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(encoded, &data); err != nil {
+		return fmt.Errorf("unable to set Data from %T; want a struct or map", v)
+	}
+
+	var verr ValidationError
+	checkStringLeaves(&verr, "", data)
+	if err := verr.Err(); err != nil {
+		return err
+	}
+
+	resp.Data = data
+	return nil
+}
+
+// checkStringLeaves records an error for each value within v that is not a
+// string; objects and arrays are traversed
+func checkStringLeaves(verr *ValidationError, path string, v interface{}) {
+	switch v := v.(type) {
+	case string:
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := k
+			if path != "" {
+				child = path + "." + k
+			}
+			checkStringLeaves(verr, child, v[k])
+		}
+	case []interface{}:
+		for i, item := range v {
+			checkStringLeaves(verr, fmt.Sprintf("%v[%v]", path, i), item)
+		}
+	default:
+		verr.Addf(path, "must be a string; got %v", typeOf(v))
+	}
+}
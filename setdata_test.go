@@ -0,0 +1,86 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSetData(t *testing.T) {
+	type endpoint struct {
+		Address string `json:"Address"`
+		Port    int    `json:"Port"`
+	}
+
+	testCases := map[string]struct {
+		Value interface{}
+		Want  map[string]interface{}
+		Err   string
+	}{
+		"strings": {
+			Value: struct {
+				Arn  string `json:"Arn"`
+				Name string `json:"BucketName"`
+				Skip string `json:"-"`
+			}{Arn: "arn:aws:s3:::bucket", Name: "bucket", Skip: "skip"},
+			Want: map[string]interface{}{"Arn": "arn:aws:s3:::bucket", "BucketName": "bucket"},
+		},
+		"nested strings": {
+			Value: struct {
+				Endpoint struct {
+					Address string `json:"Address"`
+				} `json:"Endpoint"`
+			}{},
+			Want: map[string]interface{}{"Endpoint": map[string]interface{}{"Address": ""}},
+		},
+		"numbers": {
+			Value: struct {
+				Arn      string   `json:"Arn"`
+				Count    int      `json:"Count"`
+				Endpoint endpoint `json:"Endpoint"`
+				Enabled  bool     `json:"Enabled"`
+				Tags     []string `json:"Tags"`
+			}{Tags: []string{"a"}},
+			Err: "validation failed: Count: must be a string; got integer; Enabled: must be a string; got boolean; Endpoint.Port: must be a string; got integer",
+		},
+		"not an object": {
+			Value: []string{"a"},
+			Err:   "unable to set Data from []string; want a struct or map",
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			resp := &Response{}
+			err := SetData(resp, tc.Value)
+			if tc.Err != "" {
+				if err == nil || err.Error() != tc.Err {
+					t.Fatalf("got %v; want %v", err, tc.Err)
+				}
+				if resp.Data != nil {
+					t.Fatalf("got %v; want nil", resp.Data)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := resp.Data, tc.Want; !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
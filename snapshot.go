@@ -0,0 +1,163 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// snapshotSamples bounds the durations retained, per request type, for
+// computing percentiles
+const snapshotSamples = 1024
+
+// localStats aggregates invocations in memory for MetricsSnapshot
+type localStats struct {
+	mutex        sync.Mutex
+	requestTypes map[string]*requestTypeStats
+}
+
+type requestTypeStats struct {
+	count     int64
+	outcomes  map[string]int64
+	durations []float64 // ring of the most recent snapshotSamples, in seconds
+	next      int
+}
+
+func newLocalStats() *localStats {
+	return &localStats{
+		requestTypes: map[string]*requestTypeStats{},
+	}
+}
+
+func (l *localStats) record(requestType, status string, elapsed time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	s, ok := l.requestTypes[requestType]
+	if !ok {
+		s = &requestTypeStats{outcomes: map[string]int64{}}
+		l.requestTypes[requestType] = s
+	}
+	s.count++
+	s.outcomes[status]++
+	if len(s.durations) < snapshotSamples {
+		s.durations = append(s.durations, elapsed.Seconds())
+	} else {
+		s.durations[s.next] = elapsed.Seconds()
+		s.next = (s.next + 1) % snapshotSamples
+	}
+}
+
+type snapshot struct {
+	Timestamp    time.Time                      `json:"timestamp"`
+	RequestTypes map[string]requestTypeSnapshot `json:"requestTypes"`
+}
+
+type requestTypeSnapshot struct {
+	Count    int64            `json:"count"`
+	Outcomes map[string]int64 `json:"outcomes"`
+	Duration durationSnapshot `json:"durationSeconds"`
+}
+
+type durationSnapshot struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// percentile returns the nearest-rank percentile, p, of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func (l *localStats) snapshot(now time.Time) snapshot {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	snap := snapshot{
+		Timestamp:    now.UTC(),
+		RequestTypes: map[string]requestTypeSnapshot{},
+	}
+	for requestType, s := range l.requestTypes {
+		outcomes := make(map[string]int64, len(s.outcomes))
+		for k, v := range s.outcomes {
+			outcomes[k] = v
+		}
+
+		sorted := append([]float64(nil), s.durations...)
+		sort.Float64s(sorted)
+
+		snap.RequestTypes[requestType] = requestTypeSnapshot{
+			Count:    s.count,
+			Outcomes: outcomes,
+			Duration: durationSnapshot{
+				P50: percentile(sorted, 50),
+				P90: percentile(sorted, 90),
+				P99: percentile(sorted, 99),
+				Max: percentile(sorted, 100),
+			},
+		}
+	}
+	return snap
+}
+
+// MetricsSnapshot returns, as json, the invocation counts, outcomes, and
+// duration percentiles, by request type, aggregated since the Handler was
+// created e.g.
+//
+//	{
+//	  "timestamp": "2019-03-01T12:00:00Z",
+//	  "requestTypes": {
+//	    "Create": {
+//	      "count": 3,
+//	      "outcomes": {"FAILED": 1, "SUCCESS": 2},
+//	      "durationSeconds": {"p50": 0.2, "p90": 1.5, "p99": 1.5, "max": 1.5}
+//	    }
+//	  }
+//	}
+//
+// Percentiles are computed over the most recent 1024 invocations of each
+// request type.  Returns nil unless WithMetricsSnapshot was specified.
+func (h *Handler) MetricsSnapshot() []byte {
+	if h.localStats == nil {
+		return nil
+	}
+	data, err := json.Marshal(h.localStats.snapshot(h.clock.Now()))
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// WithMetricsSnapshot aggregates metrics in memory so they may be exported
+// via Handler.MetricsSnapshot e.g. by a scheduled invocation that pushes them
+// to CloudWatch or a dashboard.  Aggregates are per Lambda container.
+func WithMetricsSnapshot() Option {
+	return func(o *options) {
+		o.metricsSnapshot = true
+	}
+}
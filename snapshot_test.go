@@ -0,0 +1,112 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHandler_MetricsSnapshot(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		clk   = &fakeClock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+		input ReplyInput
+		fn    = func(ctx context.Context, req *Request) (*Response, error) {
+			var props struct {
+				Seconds int
+				Fail    bool
+			}
+			if err := json.Unmarshal(req.ResourceProperties, &props); err != nil {
+				return nil, err
+			}
+			clk.Advance(time.Duration(props.Seconds) * time.Second)
+			if props.Fail {
+				return nil, errors.New("boom")
+			}
+			return &Response{PhysicalResourceId: "abc"}, nil
+		}
+	)
+
+	t.Run("disabled", func(t *testing.T) {
+		handler := New(fn, WithTransport(captureReply(t, &input)))
+		if got := handler.MetricsSnapshot(); got != nil {
+			t.Fatalf("got %s; want nil", got)
+		}
+	})
+
+	handler := New(fn, WithTransport(captureReply(t, &input)), WithMetricsSnapshot(), withClock(clk))
+	invocations := []struct {
+		RequestType string
+		Props       string
+	}{
+		{RequestType: RequestTypeCreate, Props: `{"Seconds":1}`},
+		{RequestType: RequestTypeCreate, Props: `{"Seconds":2}`},
+		{RequestType: RequestTypeCreate, Props: `{"Seconds":10,"Fail":true}`},
+		{RequestType: RequestTypeDelete, Props: `{"Seconds":3}`},
+	}
+	for _, i := range invocations {
+		data := marshalRequest(t, Request{RequestType: i.RequestType, ResourceProperties: json.RawMessage(i.Props)})
+		if _, err := handler.Invoke(ctx, data); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+	}
+
+	var got snapshot
+	if err := json.Unmarshal(handler.MetricsSnapshot(), &got); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	want := snapshot{
+		Timestamp: clk.Now(),
+		RequestTypes: map[string]requestTypeSnapshot{
+			RequestTypeCreate: {
+				Count:    3,
+				Outcomes: map[string]int64{StatusSuccess: 2, StatusFailed: 1},
+				Duration: durationSnapshot{P50: 2, P90: 10, P99: 10, Max: 10},
+			},
+			RequestTypeDelete: {
+				Count:    1,
+				Outcomes: map[string]int64{StatusSuccess: 1},
+				Duration: durationSnapshot{P50: 3, P90: 3, P99: 3, Max: 3},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v; want %#v", got, want)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	testCases := map[float64]float64{
+		0:   1,
+		50:  5,
+		90:  9,
+		99:  10,
+		100: 10,
+	}
+	for p, want := range testCases {
+		if got := percentile(sorted, p); got != want {
+			t.Fatalf("p%v: got %v; want %v", p, got, want)
+		}
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Fatalf("got %v; want 0", got)
+	}
+}
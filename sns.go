@@ -0,0 +1,59 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// snsEvent is the subset of the SNS event used to unwrap a request
+type snsEvent struct {
+	Records []struct {
+		EventSource string
+		Sns         struct {
+			Message string
+		}
+	}
+}
+
+// unwrapSNS returns the CloudFormation request wrapped by an SNS event or
+// payload unchanged if it is not an SNS event
+func unwrapSNS(payload []byte) ([]byte, error) {
+	var event snsEvent
+	if err := json.Unmarshal(payload, &event); err != nil || len(event.Records) == 0 {
+		return payload, nil
+	}
+	if n := len(event.Records); n != 1 {
+		return nil, fmt.Errorf("unable to process SNS event; expected 1 record, got %v", n)
+	}
+
+	record := event.Records[0]
+	if record.EventSource != "aws:sns" {
+		return nil, fmt.Errorf("unable to process event from %q; expected aws:sns", record.EventSource)
+	}
+	return []byte(record.Sns.Message), nil
+}
+
+// WithSNSEnvelope accepts requests delivered via SNS, i.e. custom resources
+// whose ServiceToken is an SNS topic subscribed to by the function.  The
+// request is unwrapped from the SNS Message before processing; the reply is
+// sent to the ResponseURL as usual.  Requests invoking the function directly
+// continue to be accepted.
+func WithSNSEnvelope(enabled bool) Option {
+	return func(o *options) {
+		o.snsEnvelope = enabled
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestWithSNSEnvelope(t *testing.T) {
+	message, err := json.Marshal(Request{
+		RequestType:        RequestTypeCreate,
+		ResponseURL:        "http://localhost",
+		StackId:            "arn:aws:cloudformation:us-east-1:123456789012:stack/my-stack/guid",
+		RequestId:          "request-id",
+		ResourceType:       "Custom::Widget",
+		LogicalResourceId:  "Resource",
+		ResourceProperties: json.RawMessage(`{"ServiceToken":"arn:aws:sns:us-east-1:123456789012:widgets","Name":"blue"}`),
+	})
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	envelope := func(source string, records int) []byte {
+		type record struct {
+			EventVersion         string
+			EventSubscriptionArn string
+			EventSource          string
+			Sns                  map[string]interface{}
+		}
+		var event struct{ Records []record }
+		for i := 0; i < records; i++ {
+			event.Records = append(event.Records, record{
+				EventVersion:         "1.0",
+				EventSubscriptionArn: "arn:aws:sns:us-east-1:123456789012:widgets:2bcfbf39-05c3-41de-beaa-fcfcc21c8f55",
+				EventSource:          source,
+				Sns: map[string]interface{}{
+					"Type":             "Notification",
+					"MessageId":        "95df01b4-ee98-5cb9-9903-4c221d41eb5e",
+					"TopicArn":         "arn:aws:sns:us-east-1:123456789012:widgets",
+					"Subject":          nil,
+					"Message":          string(message),
+					"Timestamp":        "2019-02-12T18:34:45.873Z",
+					"SignatureVersion": "1",
+				},
+			})
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		return data
+	}
+
+	testCases := map[string]struct {
+		Payload []byte
+		Err     string
+	}{
+		"sns": {
+			Payload: envelope("aws:sns", 1),
+		},
+		"direct": {
+			Payload: message,
+		},
+		"several records": {
+			Payload: envelope("aws:sns", 2),
+			Err:     "unable to process SNS event; expected 1 record, got 2",
+		},
+		"not sns": {
+			Payload: envelope("aws:sqs", 1),
+			Err:     `unable to process event from "aws:sqs"; expected aws:sns`,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx   = context.Background()
+				input ReplyInput
+				name  string
+				fn    = func(ctx context.Context, req *Request) (*Response, error) {
+					var props struct{ Name string }
+					if err := req.Decode(&props); err != nil {
+						return nil, err
+					}
+					name = props.Name
+					return &Response{PhysicalResourceId: "abc"}, nil
+				}
+			)
+
+			handler := New(fn, WithTransport(captureReply(t, &input)), WithSNSEnvelope(true))
+			_, err := handler.Invoke(ctx, tc.Payload)
+			if tc.Err != "" {
+				if err == nil || err.Error() != tc.Err {
+					t.Fatalf("got %v; want %v", err, tc.Err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Status, StatusSuccess; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := input.RequestId, "request-id"; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := name, "blue"; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// stateMarker separates the physical id from the encoded state.  The marker
+// is versioned so ids that merely contain a # are not mistaken for state.
+const stateMarker = "#crstate.v1."
+
+// EncodeState returns a PhysicalResourceId that embeds state, json encoded,
+// alongside id.  As the PhysicalResourceId is the only value CloudFormation
+// round trips between invocations, this allows state to survive from one
+// invocation to the next.  Keep state small as the id must remain well under
+// CloudFormation's 1 KB limit.
+func EncodeState(id string, state interface{}) (string, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return "", fmt.Errorf("unable to encode state: %v", err)
+	}
+	return id + stateMarker + base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeState decodes the state embedded in physicalID by EncodeState into v
+// and returns the original id.  If physicalID contains no state, physicalID is
+// returned and v is left untouched.
+func DecodeState(physicalID string, v interface{}) (string, error) {
+	index := strings.LastIndex(physicalID, stateMarker)
+	if index < 0 {
+		return physicalID, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(physicalID[index+len(stateMarker):])
+	if err != nil {
+		return "", fmt.Errorf("unable to decode state from PhysicalResourceId, %v: %v", physicalID, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return "", fmt.Errorf("unable to decode state from PhysicalResourceId, %v: %v", physicalID, err)
+	}
+
+	return physicalID[:index], nil
+}
+
+// StatefulFunc encapsulates custom resource logic that spans invocations.
+// state holds the value decoded from the incoming PhysicalResourceId, or the
+// zero value on the first invocation, and may be modified.  When done is
+// false, the updated state is encoded into the returned PhysicalResourceId so
+// the next invocation may resume from it.
+type StatefulFunc[S any] func(ctx context.Context, req *Request, state *S) (done bool, resp *Response, err error)
+
+// StatefulHandler manages the resume protocol for a StatefulFunc
+type StatefulHandler[S any] struct {
+	// Fn provides the custom resource logic
+	Fn StatefulFunc[S]
+}
+
+// Func returns a Func that decodes state from the incoming PhysicalResourceId,
+// calls Fn with the PhysicalResourceId stripped of state, and encodes the
+// updated state into the returned PhysicalResourceId.
+//
+// Note that the returned PhysicalResourceId changes whenever the state
+// changes and CloudFormation treats a changed id on Update as a replacement.
+func (s StatefulHandler[S]) Func() Func {
+	return func(ctx context.Context, req *Request) (*Response, error) {
+		TraceRoute(ctx, "StatefulHandler("+funcName(s.Fn)+")")
+
+		state := new(S)
+		id, err := DecodeState(req.PhysicalResourceId, state)
+		if err != nil {
+			return nil, err
+		}
+
+		r := *req
+		r.PhysicalResourceId = id
+
+		done, resp, err := s.Fn(ctx, &r, state)
+		if err != nil {
+			return nil, err
+		}
+		if resp == nil {
+			resp = &Response{}
+		}
+		if resp.PhysicalResourceId == "" {
+			resp.PhysicalResourceId = id
+		}
+		if done {
+			return resp, nil
+		}
+
+		resp.PhysicalResourceId, err = EncodeState(resp.PhysicalResourceId, state)
+		if err != nil {
+			return nil, err
+		}
+
+		return resp, nil
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEncodeState(t *testing.T) {
+	type State struct {
+		Step int
+	}
+
+	physicalID, err := EncodeState("abc", State{Step: 2})
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	var state State
+	id, err := DecodeState(physicalID, &state)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := id, "abc"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := state.Step, 2; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	id, err = DecodeState("plain", &state)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := id, "plain"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	// ids that merely contain a # are not state
+	id, err = DecodeState("arn:aws:s3:::bucket#abc", &state)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := id, "arn:aws:s3:::bucket#abc"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	if _, err := DecodeState("abc"+stateMarker+"!!", &state); err == nil {
+		t.Fatalf("got nil; want err")
+	}
+}
+
+func TestStatefulHandler(t *testing.T) {
+	type State struct {
+		Step int
+	}
+
+	var (
+		ctx  = context.Background()
+		seen []string
+		sh   = StatefulHandler[State]{
+			Fn: func(ctx context.Context, req *Request, state *State) (bool, *Response, error) {
+				seen = append(seen, req.PhysicalResourceId)
+				state.Step++
+				return state.Step == 2, &Response{PhysicalResourceId: "resource"}, nil
+			},
+		}
+		fn = sh.Func()
+	)
+
+	// step 1: state is encoded into the physical id
+	resp, err := fn(ctx, &Request{RequestType: RequestTypeCreate})
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	var state State
+	id, err := DecodeState(resp.PhysicalResourceId, &state)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := id, "resource"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := state.Step, 1; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	// step 2: state is resumed from the physical id and, once done, dropped
+	resp, err = fn(ctx, &Request{RequestType: RequestTypeUpdate, PhysicalResourceId: resp.PhysicalResourceId})
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := resp.PhysicalResourceId, "resource"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := seen, []string{"", "resource"}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// errHandlerTimedOut is returned when the timeout watchdog fires
+var errHandlerTimedOut = errors.New("handler timed out")
+
+// watchdogFraction of the time remaining at entry after which the timeout
+// watchdog replies FAILED, unless WithTimeoutBuffer is specified
+const watchdogFraction = 0.9
+
+// watchdogDelay returns how long the Func may run, given the time remaining
+// before the Lambda deadline, before the timeout watchdog fires
+func (h *Handler) watchdogDelay(remaining time.Duration) time.Duration {
+	var d time.Duration
+	if h.timeoutBuffer > 0 {
+		d = remaining - h.timeoutBuffer
+	} else {
+		d = time.Duration(float64(remaining) * watchdogFraction)
+	}
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
+
+// invokeWatched calls invoke, returning early with an error if a watchdog
+// fires before the Func returns.  When the ctx has a deadline, the timeout
+// watchdog fires shortly before the deadline so a FAILED reply can still be
+// sent; otherwise CloudFormation waits up to an hour for a reply.  Once a
+// watchdog fires, the Func context is canceled and its eventual result is
+// discarded so only a single reply is ever sent.
+func (h *Handler) invokeWatched(ctx context.Context, req *Request) (*Response, error) {
+	remaining, hasDeadline := h.remainingTime(ctx)
+	if !hasDeadline && h.memoryWatchdog == nil {
+		return h.invoke(ctx, req)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		resp *Response
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		resp, err := h.invoke(ctx, req)
+		ch <- result{resp: resp, err: err}
+	}()
+
+	var timeout <-chan time.Time
+	delay := h.watchdogDelay(remaining)
+	if hasDeadline {
+		timeout = h.clock.After(delay)
+	}
+
+	var sample <-chan time.Time
+	if h.memoryWatchdog != nil {
+		ticker := time.NewTicker(h.memoryWatchdog.interval)
+		defer ticker.Stop()
+		sample = ticker.C
+	}
+
+	for {
+		select {
+		case r := <-ch:
+			return r.resp, r.err
+		case <-timeout:
+			h.logf(LogError, req, "%v: %v still running after %v; replying before the Lambda deadline\n", req.LogicalResourceId, req.RequestType, delay)
+			return nil, fmt.Errorf("%w; did not return within %v of the Lambda deadline", errHandlerTimedOut, (remaining - delay).Round(time.Millisecond))
+		case <-sample:
+			if h.memoryExceeded(req) {
+				return nil, errMemoryThreshold
+			}
+		}
+	}
+}
+
+// WithTimeoutBuffer sets how long before the Lambda deadline the timeout
+// watchdog replies FAILED if the Func has not yet returned.  By default, the
+// watchdog fires once 90% of the time remaining at entry has elapsed.
+func WithTimeoutBuffer(d time.Duration) Option {
+	return func(o *options) {
+		o.timeoutBuffer = d
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTimeoutWatchdog(t *testing.T) {
+	t.Run("fires", func(t *testing.T) {
+		var (
+			replies int32
+			input   ReplyInput
+			capture = captureReply(t, &input)
+			rt      = func(req *http.Request) (*http.Response, error) {
+				atomic.AddInt32(&replies, 1)
+				return capture(req)
+			}
+			returned = make(chan struct{})
+			fn       = func(ctx context.Context, req *Request) (*Response, error) {
+				defer close(returned)
+				<-ctx.Done()
+				return &Response{PhysicalResourceId: "late"}, nil
+			}
+		)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		handler := New(fn, WithTransport(transportFunc(rt)), WithTimeoutBuffer(900*time.Millisecond))
+		started := time.Now()
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if elapsed := time.Since(started); elapsed > 500*time.Millisecond {
+			t.Fatalf("got %v; want watchdog to fire early", elapsed)
+		}
+		<-returned
+
+		if got, want := input.Status, StatusFailed; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if !strings.HasPrefix(input.Reason, "handler timed out") {
+			t.Fatalf("got %v; want timeout reason", input.Reason)
+		}
+		if got, want := atomic.LoadInt32(&replies), int32(1); got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("completes", func(t *testing.T) {
+		var (
+			replies int32
+			input   ReplyInput
+			capture = captureReply(t, &input)
+			rt      = func(req *http.Request) (*http.Response, error) {
+				atomic.AddInt32(&replies, 1)
+				return capture(req)
+			}
+			fn = func(ctx context.Context, req *Request) (*Response, error) {
+				return &Response{PhysicalResourceId: "abc"}, nil
+			}
+		)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		handler := New(fn, WithTransport(transportFunc(rt)))
+		if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		time.Sleep(150 * time.Millisecond) // past where the watchdog would have fired
+
+		if got, want := input.Status, StatusSuccess; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := atomic.LoadInt32(&replies), int32(1); got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+}
+
+func TestHandler_watchdogDelay(t *testing.T) {
+	testCases := map[string]struct {
+		Buffer    time.Duration
+		Remaining time.Duration
+		Want      time.Duration
+	}{
+		"default": {
+			Remaining: 10 * time.Second,
+			Want:      9 * time.Second,
+		},
+		"buffer": {
+			Buffer:    3 * time.Second,
+			Remaining: 10 * time.Second,
+			Want:      7 * time.Second,
+		},
+		"buffer exceeds remaining": {
+			Buffer:    time.Minute,
+			Remaining: 10 * time.Second,
+			Want:      0,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			h := New(nil, WithTimeoutBuffer(tc.Buffer))
+			if got, want := h.watchdogDelay(tc.Remaining), tc.Want; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
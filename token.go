@@ -0,0 +1,52 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"encoding/json"
+)
+
+type idempotencyTokenKey struct{}
+
+// idempotencyToken returns the idempotency token for the request; the value
+// of the configured property, if present, otherwise the RequestId
+func (h *Handler) idempotencyToken(req *Request) string {
+	if h.idempotencyTokenKey != "" && len(req.ResourceProperties) > 0 {
+		var props map[string]interface{}
+		if err := json.Unmarshal(req.ResourceProperties, &props); err == nil {
+			if token, ok := props[h.idempotencyTokenKey].(string); ok && token != "" {
+				return token
+			}
+		}
+	}
+	return req.RequestId
+}
+
+// IdempotencyToken returns a token suitable for idempotent downstream calls
+// e.g. the ClientToken of AWS api calls.  Within a Func, the token is
+// never empty and defaults to the RequestId; see WithIdempotencyTokenKey.
+func IdempotencyToken(ctx context.Context) string {
+	token, _ := ctx.Value(idempotencyTokenKey{}).(string)
+	return token
+}
+
+// WithIdempotencyTokenKey reads the token returned by IdempotencyToken from
+// the named ResourceProperties key, when present
+func WithIdempotencyTokenKey(key string) Option {
+	return func(o *options) {
+		o.idempotencyTokenKey = key
+	}
+}
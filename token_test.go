@@ -0,0 +1,66 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestIdempotencyToken(t *testing.T) {
+	testCases := map[string]struct {
+		Props json.RawMessage
+		Key   string
+		Want  string
+	}{
+		"default": {
+			Want: "request-id",
+		},
+		"configured": {
+			Props: json.RawMessage(`{"ClientRequestToken":"token"}`),
+			Key:   "ClientRequestToken",
+			Want:  "token",
+		},
+		"configured absent": {
+			Props: json.RawMessage(`{"Name":"blah"}`),
+			Key:   "ClientRequestToken",
+			Want:  "request-id",
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx   = context.Background()
+				input ReplyInput
+				got   string
+				fn    = func(ctx context.Context, req *Request) (*Response, error) {
+					got = IdempotencyToken(ctx)
+					return &Response{PhysicalResourceId: "abc"}, nil
+				}
+			)
+
+			handler := New(fn, WithTransport(captureReply(t, &input)), WithIdempotencyTokenKey(tc.Key))
+			data := marshalRequest(t, Request{RequestType: RequestTypeCreate, RequestId: "request-id", ResourceProperties: tc.Props})
+			if _, err := handler.Invoke(ctx, data); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if want := tc.Want; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
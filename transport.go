@@ -0,0 +1,47 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"net/http"
+)
+
+// TransportWrapper decorates the RoundTripper used to send replies e.g. to
+// add headers, logging, or a proxy dialer
+type TransportWrapper func(http.RoundTripper) http.RoundTripper
+
+// wrapTransport returns base decorated by wrappers.  The first wrapper is the
+// outermost and so sees each request first and each response last.
+func wrapTransport(base http.RoundTripper, wrappers []TransportWrapper) http.RoundTripper {
+	transport := base
+	for i := len(wrappers) - 1; i >= 0; i-- {
+		transport = wrappers[i](transport)
+	}
+	return transport
+}
+
+// WithTransportWrapper decorates the reply transport with wrappers.  The
+// effective transport is assembled, from the outside in, as
+//
+//	wrappers, in the order given across all WithTransportWrapper options
+//	the chaos transport, if WithChaos is set
+//	the transport from WithTransport, by default http.DefaultTransport
+//
+// so the first wrapper sees each request first.
+func WithTransportWrapper(wrappers ...TransportWrapper) Option {
+	return func(o *options) {
+		o.transportWrappers = append(o.transportWrappers, wrappers...)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestWithTransportWrapper(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		input ReplyInput
+		calls []string
+		fn    = func(ctx context.Context, req *Request) (*Response, error) {
+			return &Response{PhysicalResourceId: "abc"}, nil
+		}
+		base = func(req *http.Request) (*http.Response, error) {
+			calls = append(calls, "base")
+			return captureReply(t, &input)(req)
+		}
+		wrapper = func(name string) TransportWrapper {
+			return func(next http.RoundTripper) http.RoundTripper {
+				return transportFunc(func(req *http.Request) (*http.Response, error) {
+					calls = append(calls, name+" before")
+					resp, err := next.RoundTrip(req)
+					calls = append(calls, name+" after")
+					return resp, err
+				})
+			}
+		}
+	)
+
+	handler := New(fn,
+		WithTransport(transportFunc(base)),
+		WithTransportWrapper(wrapper("a"), wrapper("b")),
+		WithTransportWrapper(wrapper("c")),
+	)
+	if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := input.Status, StatusSuccess; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	want := []string{"a before", "b before", "c before", "base", "c after", "b after", "a after"}
+	if got := calls; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
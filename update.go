@@ -0,0 +1,61 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+)
+
+// TypedUpdateFunc receives the ResourceProperties and OldResourceProperties
+// decoded into the values returned by TypedUpdate.NewProps
+type TypedUpdateFunc func(ctx context.Context, req *Request, props, oldProps interface{}) (*Response, error)
+
+// TypedUpdate decodes properties prior to calling Fn
+type TypedUpdate struct {
+	// NewProps returns a pointer to a new, zero valued, properties struct
+	NewProps func() interface{}
+	// Fn provides the custom resource logic
+	Fn TypedUpdateFunc
+	// Strict fails Update requests whose OldResourceProperties are absent or
+	// malformed.  By default, oldProps is left as the zero value and a warning
+	// is logged as OldResourceProperties may be absent in edge cases such as
+	// the first update after an import.
+	Strict bool
+}
+
+// Func returns a Func that decodes properties and calls Fn
+func (u TypedUpdate) Func() Func {
+	return func(ctx context.Context, req *Request) (*Response, error) {
+		TraceRoute(ctx, "TypedUpdate("+funcName(u.Fn)+")")
+
+		props := u.NewProps()
+		if err := req.Decode(props); err != nil {
+			return nil, err
+		}
+
+		oldProps := u.NewProps()
+		if req.RequestType == RequestTypeUpdate {
+			if err := req.DecodeOld(oldProps); err != nil {
+				if u.Strict {
+					return nil, err
+				}
+				logf(ctx, LogWarn, "%v: warning - %v; using zero value\n", req.LogicalResourceId, err)
+				oldProps = u.NewProps()
+			}
+		}
+
+		return u.Fn(ctx, req, props, oldProps)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestTypedUpdate(t *testing.T) {
+	type Props struct {
+		Name string
+	}
+
+	testCases := map[string]struct {
+		Old     json.RawMessage
+		Strict  bool
+		Status  string
+		OldName string
+		Warning bool
+	}{
+		"ok": {
+			Old:     json.RawMessage(`{"Name":"old"}`),
+			Status:  StatusSuccess,
+			OldName: "old",
+		},
+		"absent": {
+			Status:  StatusSuccess,
+			Warning: true,
+		},
+		"empty": {
+			Old:     json.RawMessage(`""`),
+			Status:  StatusSuccess,
+			Warning: true,
+		},
+		"malformed": {
+			Old:     json.RawMessage(`{"Name":42}`),
+			Status:  StatusSuccess,
+			Warning: true,
+		},
+		"strict absent": {
+			Strict: true,
+			Status: StatusFailed,
+		},
+		"strict malformed": {
+			Old:    json.RawMessage(`{"Name":42}`),
+			Strict: true,
+			Status: StatusFailed,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx     = context.Background()
+				buf     = bytes.NewBuffer(nil)
+				input   ReplyInput
+				name    string
+				oldName string
+				update  = TypedUpdate{
+					NewProps: func() interface{} { return &Props{} },
+					Fn: func(ctx context.Context, req *Request, props, oldProps interface{}) (*Response, error) {
+						name = props.(*Props).Name
+						oldName = oldProps.(*Props).Name
+						return &Response{PhysicalResourceId: req.PhysicalResourceId}, nil
+					},
+					Strict: tc.Strict,
+				}
+			)
+
+			handler := New(update.Func(), WithTransport(captureReply(t, &input)), WithOutput(buf))
+			data := marshalRequest(t, Request{
+				RequestType:           RequestTypeUpdate,
+				PhysicalResourceId:    "abc",
+				ResourceProperties:    json.RawMessage(`{"Name":"new"}`),
+				OldResourceProperties: tc.Old,
+			})
+			if _, err := handler.Invoke(ctx, data); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Status, tc.Status; got != want {
+				t.Fatalf("got %v; want %v: %v", got, want, input.Reason)
+			}
+			if tc.Status == StatusFailed {
+				return
+			}
+			if got, want := name, "new"; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := oldName, tc.OldName; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := strings.Contains(buf.String(), "warning"), tc.Warning; got != want {
+				t.Fatalf("got %v; want %v: %v", got, want, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"fmt"
+)
+
+// FieldError describes a single invalid field
+type FieldError struct {
+	// Path to the invalid field e.g. properties.Database.Port
+	Path string
+	// Message describing the problem e.g. must be an integer
+	Message string
+}
+
+// String implements fmt.Stringer
+func (f FieldError) String() string {
+	return f.Path + ": " + f.Message
+}
+
+// ValidationError aggregates field errors so a single FAILED reason can
+// report every invalid property e.g.
+//
+//	var v customresource.ValidationError
+//	if props.Port <= 0 {
+//		v.Add("properties.Database.Port", "must be a positive integer")
+//	}
+//	if err := v.Err(); err != nil {
+//		return nil, err
+//	}
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Add records message against the field at path
+func (v *ValidationError) Add(path, message string) {
+	v.Fields = append(v.Fields, FieldError{Path: path, Message: message})
+}
+
+// Addf records a formatted message against the field at path
+func (v *ValidationError) Addf(path, format string, args ...interface{}) {
+	v.Add(path, fmt.Sprintf(format, args...))
+}
+
+// Err returns v if any field errors have been added; nil otherwise
+func (v *ValidationError) Err() error {
+	if v == nil || len(v.Fields) == 0 {
+		return nil
+	}
+	return v
+}
+
+// Error implements error; the message is limited to CloudFormation's maximum
+// reason length
+func (v *ValidationError) Error() string {
+	return v.Format(maxReasonLength)
+}
+
+// Format returns the field errors as a single line of at most max bytes.
+// Field errors that do not fit are summarized by count.
+func (v *ValidationError) Format(max int) string {
+	s := "validation failed: "
+	for i, f := range v.Fields {
+		item := f.String()
+		if i > 0 {
+			item = "; " + item
+		}
+
+		// leave room to summarize the fields that follow
+		more := ""
+		if n := len(v.Fields) - i - 1; n > 0 {
+			more = fmt.Sprintf("; and %v more", n)
+		}
+		if len(s)+len(item)+len(more) > max {
+			summary := fmt.Sprintf("and %v more", len(v.Fields)-i)
+			if i > 0 {
+				summary = "; " + summary
+			}
+			s += summary
+			break
+		}
+		s += item
+	}
+
+	return truncateReason(s, max)
+}
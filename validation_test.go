@@ -0,0 +1,141 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestValidationError(t *testing.T) {
+	t.Run("empty", func(t *testing.T) {
+		var v ValidationError
+		if err := v.Err(); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+	})
+
+	t.Run("multiple", func(t *testing.T) {
+		var v ValidationError
+		v.Add("properties.Database.Port", "must be an integer")
+		v.Addf("properties.Database.Name", "must be at most %v characters", 63)
+
+		err := v.Err()
+		if err == nil {
+			t.Fatalf("got nil; want error")
+		}
+		want := "validation failed: properties.Database.Port: must be an integer; properties.Database.Name: must be at most 63 characters"
+		if got := err.Error(); got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+
+		var target *ValidationError
+		if !errors.As(err, &target) {
+			t.Fatalf("got false; want true")
+		}
+		if got, want := len(target.Fields), 2; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		var v ValidationError
+		v.Add("a", "is required")
+		v.Add("b", "is required")
+		v.Add("c", "is required")
+
+		testCases := map[string]struct {
+			Max  int
+			Want string
+		}{
+			"fits": {
+				Max:  200,
+				Want: "validation failed: a: is required; b: is required; c: is required",
+			},
+			"partial": {
+				Max:  50,
+				Want: "validation failed: a: is required; and 2 more",
+			},
+			"none": {
+				Max:  40,
+				Want: "validation failed: and 3 more",
+			},
+		}
+
+		for label, tc := range testCases {
+			t.Run(label, func(t *testing.T) {
+				got := v.Format(tc.Max)
+				if got != tc.Want {
+					t.Fatalf("got %v; want %v", got, tc.Want)
+				}
+				if len(got) > tc.Max {
+					t.Fatalf("got %v; want <= %v", len(got), tc.Max)
+				}
+			})
+		}
+	})
+
+	t.Run("multi-byte", func(t *testing.T) {
+		var v ValidationError
+		v.Add("Name", "must not contain ☃")
+		v.Add("Ünïcödé", "is required")
+
+		for max := 0; max <= len(v.Format(maxReasonLength)); max++ {
+			if got := v.Format(max); !utf8.ValidString(got) || len(got) > max {
+				t.Fatalf("got %q; want valid utf8 of at most %v bytes", got, max)
+			}
+		}
+	})
+
+	t.Run("reason limit", func(t *testing.T) {
+		var v ValidationError
+		for i := 0; i < 1000; i++ {
+			v.Add("properties.Items", strings.Repeat("x", 20))
+		}
+		if got := len(v.Error()); got > maxReasonLength {
+			t.Fatalf("got %v; want <= %v", got, maxReasonLength)
+		}
+		if !strings.HasSuffix(v.Error(), "more") {
+			t.Fatalf("got %v; want summary suffix", v.Error())
+		}
+	})
+}
+
+func TestValidationErrorReason(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		input ReplyInput
+		fn    = func(ctx context.Context, req *Request) (*Response, error) {
+			var v ValidationError
+			v.Add("properties.Database.Port", "must be an integer")
+			v.Add("properties.Database.Name", "is required")
+			return nil, v.Err()
+		}
+	)
+
+	handler := New(fn, WithTransport(captureReply(t, &input)))
+	if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := input.Status, StatusFailed; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := input.Reason, "validation failed: properties.Database.Port: must be an integer; properties.Database.Name: is required"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
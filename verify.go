@@ -0,0 +1,53 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"fmt"
+)
+
+// verifyCreate confirms the resource reported by resp is usable
+func (h *Handler) verifyCreate(ctx context.Context, req *Request, resp *Response) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("unable to verify %v: %v", resp.PhysicalResourceId, err)
+	}
+	if err := h.safeVerify(ctx, req, resp); err != nil {
+		if p, ok := err.(panicError); ok {
+			p.error = fmt.Errorf("verification of %v panicked: %w", resp.PhysicalResourceId, p.error)
+			return p
+		}
+		return fmt.Errorf("verification of %v failed: %v", resp.PhysicalResourceId, err)
+	}
+	h.logf(LogDebug, req, "%v: %v verified. PhysicalResourceId=%v\n", req.LogicalResourceId, req.RequestType, resp.PhysicalResourceId)
+	return nil
+}
+
+// safeVerify calls the verify hook, returning a panicError if it panics
+func (h *Handler) safeVerify(ctx context.Context, req *Request, resp *Response) (err error) {
+	defer recoverPanic(&err)
+	return h.createVerify(ctx, req, resp)
+}
+
+// WithCreateVerify calls verify after the Func returns successfully from a
+// Create to confirm the resource exists and is usable before replying
+// SUCCESS.  If verify returns an error, the Handler replies FAILED instead.
+// verify receives the invocation context and should return promptly once it
+// is done; verification counts against the same deadline as the Func.
+func WithCreateVerify(verify func(ctx context.Context, req *Request, resp *Response) error) Option {
+	return func(o *options) {
+		o.createVerify = verify
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2019 Matt Ho
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package customresource
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithCreateVerify(t *testing.T) {
+	testCases := map[string]struct {
+		RequestType string
+		VerifyErr   error
+		Status      string
+		Verified    bool
+		Reason      string
+	}{
+		"verified": {
+			RequestType: RequestTypeCreate,
+			Status:      StatusSuccess,
+			Verified:    true,
+		},
+		"unhealthy": {
+			RequestType: RequestTypeCreate,
+			VerifyErr:   errors.New("bucket not found"),
+			Status:      StatusFailed,
+			Verified:    true,
+			Reason:      "verification of abc failed: bucket not found",
+		},
+		"update skipped": {
+			RequestType: RequestTypeUpdate,
+			VerifyErr:   errors.New("bucket not found"),
+			Status:      StatusSuccess,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var (
+				ctx      = context.Background()
+				input    ReplyInput
+				verified bool
+				fn       = func(ctx context.Context, req *Request) (*Response, error) {
+					return &Response{PhysicalResourceId: "abc"}, nil
+				}
+				verify = func(ctx context.Context, req *Request, resp *Response) error {
+					verified = true
+					if resp.PhysicalResourceId != "abc" {
+						t.Fatalf("got %v; want abc", resp.PhysicalResourceId)
+					}
+					return tc.VerifyErr
+				}
+			)
+
+			handler := New(fn, WithTransport(captureReply(t, &input)), WithCreateVerify(verify))
+			data := marshalRequest(t, Request{RequestType: tc.RequestType, PhysicalResourceId: "abc"})
+			if _, err := handler.Invoke(ctx, data); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if got, want := input.Status, tc.Status; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := verified, tc.Verified; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+			if got, want := input.Reason, tc.Reason; got != want {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestWithCreateVerifyDefaultPhysicalID(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		input ReplyInput
+		gotID string
+		fn    = func(ctx context.Context, req *Request) (*Response, error) {
+			return &Response{}, nil
+		}
+		verify = func(ctx context.Context, req *Request, resp *Response) error {
+			gotID = resp.PhysicalResourceId
+			return nil
+		}
+		req = Request{RequestType: RequestTypeCreate, StackId: "stack", LogicalResourceId: "Resource"}
+	)
+
+	handler := New(fn, WithTransport(captureReply(t, &input)), WithCreateVerify(verify))
+	if _, err := handler.Invoke(ctx, marshalRequest(t, req)); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := gotID, defaultPhysicalID(&req); got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := input.PhysicalResourceId, gotID; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+func TestWithCreateVerifyPanic(t *testing.T) {
+	var (
+		input ReplyInput
+		fn    = func(ctx context.Context, req *Request) (*Response, error) {
+			return &Response{PhysicalResourceId: "abc"}, nil
+		}
+		verify = func(ctx context.Context, req *Request, resp *Response) error {
+			panic("boom")
+		}
+	)
+
+	// with a deadline, the Func and verify hook run on the watchdog goroutine
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	handler := New(fn, WithTransport(captureReply(t, &input)), WithCreateVerify(verify))
+	if _, err := handler.Invoke(ctx, marshalRequest(t, Request{RequestType: RequestTypeCreate})); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, want := input.Status, StatusFailed; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if want := "verification of abc panicked: recovered from boom at "; !strings.HasPrefix(input.Reason, want) {
+		t.Fatalf("got %v; want prefix %v", input.Reason, want)
+	}
+	if got, want := input.PhysicalResourceId, "abc"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}